@@ -1,158 +1,323 @@
 package common
 
 import (
-	"bytes"
-	"encoding/gob"
+	"context"
 	"github.com/streadway/amqp"
+	"github.com/xor-shift/teleserver/util"
 	"log"
-	"os"
 	"sync"
+	"time"
 )
 
-type AMQPConsumer struct {
-	amqpConn  *amqp.Connection
-	amqpChan  *amqp.Channel
-	amqpQueue amqp.Queue
+// amqpSubscription consumes the packets published to PacketExchange that match the bindings of its queue, resuming
+// consumption whenever the connection to the broker is re-established.
+//
+// Failed deliveries are put back at the end of the queue through the default exchange until they run out of retries,
+// after which they are dead-lettered to DeadLetterQueue. The channel is in confirm mode and the original delivery is
+// only acked once the broker confirms its copy within AMQP_CONFIRM_TIMEOUT (5s), deliveries that can't be republished
+// are requeued so that they are never lost.
+type amqpSubscription struct {
+	connection *AMQPConnection
 
-	queueName    string
-	consumerName string
+	queueConfig    QueueConfig
+	consumerName   string
+	retryPolicy    retryPolicy
+	confirmTimeout time.Duration
 
-	amqpConsumer <-chan amqp.Delivery
-	callback     func(amqp.Delivery) error
-	wg           sync.WaitGroup
+	handler func(*Delivery)
+	wg      sync.WaitGroup
+	// retries tracks the failed deliveries that are waiting to be retried
+	retries sync.WaitGroup
+
+	// mutex makes sure that Stop doesn't race with the registration of the consumer on a new channel, it also
+	// guards queueName which changes with every channel if the broker names the queue
+	mutex     sync.Mutex
+	queueName string
+	stopping  context.Context
+	stop      context.CancelFunc
+
+	// publishMutex serialises republishing, it guards the fields below which are replaced by setup on every new channel
+	publishMutex   sync.Mutex
+	publishChannel *amqp.Channel
+	confirms       <-chan amqp.Confirmation
+	// nextTag is the delivery tag of the next publishing on the channel
+	nextTag uint64
 }
 
-func NewAMQPConsumer(queueName, consumerName string, callback func(amqp.Delivery) error) (*AMQPConsumer, error) {
+func newAMQPSubscription(queueConfig QueueConfig, consumerName string, handler func(*Delivery)) (*amqpSubscription, error) {
 	var err error
-	consumer := AMQPConsumer{
-		callback: callback,
+	subscription := amqpSubscription{
+		handler: handler,
 
-		queueName:    queueName,
+		queueConfig:  queueConfig,
 		consumerName: consumerName,
-	}
 
-	if consumer.amqpConn, err = amqp.Dial(os.Getenv("AMQP_URL")); err != nil {
-		return nil, err
+		queueName: queueConfig.Queue,
 	}
 
-	if consumer.amqpChan, err = consumer.amqpConn.Channel(); err != nil {
-		_ = consumer.amqpConn.Close()
-		return nil, err
-	}
+	subscription.stopping, subscription.stop = context.WithCancel(context.Background())
 
-	if err = consumer.amqpChan.ExchangeDeclare(
-		"full_packets", // name
-		"fanout",       // type
-		true,           // durable
-		false,          // auto-deleted
-		false,          // internal
-		false,          // no-wait
-		nil,            // arguments
-	); err != nil {
-		_ = consumer.amqpChan.Close()
-		_ = consumer.amqpConn.Close()
+	if subscription.retryPolicy, err = retryPolicyFromEnv(); err != nil {
 		return nil, err
 	}
 
-	if consumer.amqpQueue, err = consumer.amqpChan.QueueDeclare(
-		queueName, // name
-		false,     // durable
-		false,     // delete when unused
-		true,      // exclusive
-		false,     // no-wait
-		nil,       // arguments
-	); err != nil {
-		_ = consumer.amqpChan.Close()
-		_ = consumer.amqpConn.Close()
+	if subscription.confirmTimeout, err = util.GetenvDuration("AMQP_CONFIRM_TIMEOUT", 5*time.Second); err != nil {
 		return nil, err
 	}
 
-	if err = consumer.amqpChan.QueueBind(
-		consumer.amqpQueue.Name, // queue name
-		"",                      // routing key
-		"full_packets",          // exchange
-		false,
-		nil,
-	); err != nil {
-		_ = consumer.amqpChan.Close()
-		_ = consumer.amqpConn.Close()
+	if subscription.connection, err = NewAMQPConnection(subscription.setup); err != nil {
 		return nil, err
 	}
 
-	return &consumer, nil
+	subscription.start()
+
+	return &subscription, nil
 }
 
-func (c *AMQPConsumer) Start() error {
+// setup declares the topology of the consumer and puts the channel in confirm mode, it's called on every new channel
+func (c *amqpSubscription) setup(amqpChan *amqp.Channel) error {
 	var err error
 
-	if c.amqpConsumer, err = c.amqpChan.Consume(
-		c.amqpQueue.Name, // queue
-		c.consumerName,   // consumer
-		true,             // auto-ack
-		false,            // exclusive
-		false,            // no-local
-		false,            // no-wait
-		nil,              // args
-	); err != nil {
+	if err = amqpChan.Qos(int(c.queueConfig.Prefetch), 0, false); err != nil {
+		return err
+	}
+
+	if err = amqpChan.Confirm(false); err != nil {
 		return err
 	}
 
+	c.publishMutex.Lock()
+	c.publishChannel = amqpChan
+	c.confirms = amqpChan.NotifyPublish(make(chan amqp.Confirmation, 64))
+	c.nextTag = 1
+	c.publishMutex.Unlock()
+
+	if err = DeclareDeadLetters(amqpChan); err != nil {
+		return err
+	}
+
+	queueName, err := c.queueConfig.declare(amqpChan)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.queueName = queueName
+	c.mutex.Unlock()
+
+	return nil
+}
+
+func (c *amqpSubscription) currentQueueName() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.queueName
+}
+
+// consume registers the consumer on the current channel, it returns a nil channel if the consumer was stopped
+func (c *amqpSubscription) consume() (<-chan amqp.Delivery, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stopping.Err() != nil {
+		return nil, nil
+	}
+
+	amqpChan, err := c.connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	return amqpChan.Consume(
+		c.queueName,    // queue
+		c.consumerName, // consumer
+		false,          // auto-ack
+		false,          // exclusive
+		false,          // no-local
+		false,          // no-wait
+		nil,            // args
+	)
+}
+
+func (c *amqpSubscription) start() {
 	c.wg.Add(1)
 
 	go func() {
 		defer func() { c.wg.Done() }()
 
 		for {
-			delivery, open := <-c.amqpConsumer
-			if !open {
-				break
+			if err := c.connection.WaitConnected(c.stopping); err != nil {
+				return
+			}
+
+			deliveries, err := c.consume()
+			if err != nil {
+				// the connection was most likely lost and is about to be re-established
+				log.Printf("failed to start consuming from %s: %s", c.currentQueueName(), err)
+
+				select {
+				case <-time.After(time.Second):
+				case <-c.stopping.Done():
+				}
+
+				continue
 			}
 
-			c.callback(delivery)
+			if deliveries == nil {
+				return
+			}
+
+			for delivery := range deliveries {
+				c.handle(delivery)
+			}
+
+			if c.stopping.Err() != nil {
+				return
+			}
+
+			log.Printf("the deliveries of %s stopped, waiting for the connection to come back", c.currentQueueName())
 		}
 	}()
+}
 
-	return nil
+// handle passes a delivery to the handler, which acks or fails it
+func (c *amqpSubscription) handle(amqpDelivery amqp.Delivery) {
+	queueName := c.currentQueueName()
+
+	c.handler(&Delivery{
+		Message: Message{
+			RoutingKey:  amqpDelivery.RoutingKey,
+			ContentType: amqpDelivery.ContentType,
+			Headers:     amqpDelivery.Headers,
+			Body:        amqpDelivery.Body,
+		},
+		Retries: DeliveryRetries(&amqpDelivery),
+
+		ack: func() error {
+			return amqpDelivery.Ack(false)
+		},
+		fail: func(err error) error {
+			return c.fail(&amqpDelivery, queueName, err)
+		},
+	})
 }
 
-func (c *AMQPConsumer) Stop() error {
-	var err error
+// fail retries or dead-letters a delivery depending on the error and the number of times it was retried. Retries are
+// republished in the background once their delay is over, the delivery stays unacked until then.
+func (c *amqpSubscription) fail(delivery *amqp.Delivery, queueName string, err error) error {
+	retries := DeliveryRetries(delivery)
 
-	if err = c.amqpChan.Cancel(c.consumerName, false); err != nil {
-		return err
+	delay, retry := c.retryPolicy.delay(retries, err)
+	if !retry {
+		log.Printf("dead-lettering a delivery from %s after %d retries: %s", queueName, retries, err)
+		return c.republish(delivery, queueName, DeadLetterExchange, "", deadLetterHeaders(queueName, err))
 	}
 
+	log.Printf("failed to process a delivery from %s (retry %d/%d in %s): %s", queueName, retries+1, c.retryPolicy.maxRetries, delay, err)
+
+	c.retries.Add(1)
+
+	go func() {
+		defer c.retries.Done()
+
+		select {
+		case <-time.After(delay):
+		case <-c.stopping.Done():
+			_ = delivery.Nack(false, true)
+			return
+		}
+
+		// straight to the queue through the default exchange
+		_ = c.republish(delivery, queueName, "", queueName, amqp.Table{HeaderRetries: int32(retries + 1)})
+	}()
+
 	return nil
 }
 
-func (c *AMQPConsumer) Wait() {
-	c.wg.Wait()
+// republish publishes a copy of a delivery with extra headers and acks the original once the broker confirms the copy.
+// The original is requeued instead if the copy can't be published or isn't confirmed.
+func (c *amqpSubscription) republish(delivery *amqp.Delivery, queueName string, exchange string, routingKey string, headers amqp.Table) error {
+	if err := c.publishConfirmed(exchange, routingKey, RepublishDelivery(delivery, headers)); err != nil {
+		log.Printf("failed to republish a delivery from %s, requeueing it: %s", queueName, err)
+		return delivery.Nack(false, true)
+	}
+
+	return delivery.Ack(false)
 }
 
-func (c *AMQPConsumer) Close() error {
-	var err error
+// publishConfirmed publishes a message and waits for the broker to confirm it
+func (c *amqpSubscription) publishConfirmed(exchange string, routingKey string, publishing amqp.Publishing) error {
+	c.publishMutex.Lock()
+	defer c.publishMutex.Unlock()
 
-	if err = c.amqpChan.Close(); err != nil {
-		return err
+	if c.publishChannel == nil {
+		return ErrAMQPNotConnected
 	}
 
-	if err = c.amqpConn.Close(); err != nil {
+	if err := c.publishChannel.Publish(exchange, routingKey, false, false, publishing); err != nil {
 		return err
 	}
 
-	return nil
+	tag := c.nextTag
+	c.nextTag++
+
+	timer := time.NewTimer(c.confirmTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case confirmation, ok := <-c.confirms:
+			if !ok {
+				return amqp.ErrClosed
+			}
+
+			// confirmations of earlier publishings that timed out
+			if confirmation.DeliveryTag < tag {
+				continue
+			}
+
+			if !confirmation.Ack {
+				return errNacked
+			}
+
+			return nil
+		case <-timer.C:
+			return errNotConfirmed
+		}
+	}
 }
 
-func ParseAMQPPacket(delivery *amqp.Delivery) (AMQPPacket, error) {
-	var err error
-	var amqpPacket AMQPPacket
+// Stop stops consuming and waits for the deliveries that were already received to be passed to the handler. Retries
+// that are waiting for their delay are requeued right away.
+func (c *amqpSubscription) Stop(ctx context.Context) error {
+	c.mutex.Lock()
+	c.stop()
+	amqpChan, err := c.connection.Channel()
+	if err == nil {
+		err = amqpChan.Cancel(c.consumerName, false)
+	} else {
+		// nothing is being consumed
+		err = nil
+	}
+	c.mutex.Unlock()
 
-	buffer := bytes.NewBuffer(delivery.Body)
-	decoder := gob.NewDecoder(buffer)
+	waitErr := WaitContext(ctx, c.wg.Wait)
 
-	if err = decoder.Decode(&amqpPacket); err != nil {
-		log.Printf("error decoding a packet with gob: %s", err)
+	if err != nil {
+		return err
 	}
 
-	return amqpPacket, nil
+	return waitErr
+}
+
+func (c *amqpSubscription) Health() BusHealth {
+	return c.connection.Health()
+}
+
+// Close closes the connection once the retries are requeued, deliveries that weren't acked are redelivered
+func (c *amqpSubscription) Close() error {
+	c.retries.Wait()
+
+	return c.connection.Close()
 }
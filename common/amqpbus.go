@@ -0,0 +1,206 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"github.com/xor-shift/teleserver/util"
+	"sync"
+	"time"
+)
+
+var (
+	errNotConfirmed = errors.New("the broker did not confirm the message in time")
+	errNacked       = errors.New("the broker rejected the message")
+)
+
+// AMQPBus is a Bus backed by the broker at AMQP_URL.
+//
+// Messages are published as persistent and mandatory on a channel in confirm mode, the outcome of a message is known
+// once the broker confirms it or AMQP_CONFIRM_TIMEOUT (5s) expires. Every subscription has a connection of its own.
+type AMQPBus struct {
+	connection *AMQPConnection
+	timeout    time.Duration
+
+	// mutex guards the fields below, which are replaced by setup on every new channel
+	mutex    *sync.Mutex
+	channel  *amqp.Channel
+	confirms <-chan amqp.Confirmation
+	returns  <-chan amqp.Return
+	// nextTag is the delivery tag of the next publishing on the channel
+	nextTag uint64
+
+	// batchNo tells the returns of different batches apart, it's only used by publish
+	batchNo uint64
+}
+
+func NewAMQPBus() (*AMQPBus, error) {
+	var err error
+
+	bus := &AMQPBus{
+		mutex: &sync.Mutex{},
+	}
+
+	if bus.timeout, err = util.GetenvDuration("AMQP_CONFIRM_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+
+	if bus.connection, err = NewAMQPConnection(bus.setup); err != nil {
+		return nil, err
+	}
+
+	return bus, nil
+}
+
+// setup declares the packet exchange and puts the channel in confirm mode, it's called on every new channel
+func (bus *AMQPBus) setup(amqpChan *amqp.Channel) error {
+	if err := declarePacketExchange(amqpChan); err != nil {
+		return err
+	}
+
+	if err := amqpChan.Confirm(false); err != nil {
+		return err
+	}
+
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.channel = amqpChan
+	bus.confirms = amqpChan.NotifyPublish(make(chan amqp.Confirmation, 1024))
+	bus.returns = amqpChan.NotifyReturn(make(chan amqp.Return, 1024))
+	bus.nextTag = 1
+
+	return nil
+}
+
+func (bus *AMQPBus) Publish(messages []Message) []error {
+	errs := make([]error, len(messages))
+
+	bus.mutex.Lock()
+	amqpChan := bus.channel
+	confirms := bus.confirms
+	returns := bus.returns
+	bus.mutex.Unlock()
+
+	if amqpChan == nil {
+		for i := range errs {
+			errs[i] = ErrAMQPNotConnected
+		}
+
+		return errs
+	}
+
+	// leftovers from batches that timed out
+	for drained := false; !drained; {
+		select {
+		case <-confirms:
+		case <-returns:
+		default:
+			drained = true
+		}
+	}
+
+	bus.batchNo++
+
+	// delivery tag -> index of the message
+	inFlight := map[uint64]int{}
+
+	handleReturn := func(ret amqp.Return) {
+		var batchNo uint64
+		var i int
+
+		if _, err := fmt.Sscanf(ret.MessageId, "%d/%d", &batchNo, &i); err != nil || batchNo != bus.batchNo || i < 0 || i >= len(errs) {
+			return
+		}
+
+		errs[i] = errors.New(fmt.Sprintf("the message was returned: %s", ret.ReplyText))
+	}
+
+	for i, message := range messages {
+		err := amqpChan.Publish(
+			PacketExchange,
+			message.RoutingKey,
+			true,
+			false,
+			amqp.Publishing{
+				ContentType: message.ContentType,
+				Headers:     message.Headers,
+				// survives broker restarts when routed to durable queues
+				DeliveryMode: amqp.Persistent,
+				// identifies the message if it's returned
+				MessageId: fmt.Sprintf("%d/%d", bus.batchNo, i),
+				Body:      message.Body,
+			})
+
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		bus.mutex.Lock()
+		inFlight[bus.nextTag] = i
+		bus.nextTag++
+		bus.mutex.Unlock()
+	}
+
+	timer := time.NewTimer(bus.timeout)
+	defer timer.Stop()
+
+	for len(inFlight) != 0 {
+		select {
+		case ret := <-returns:
+			// returns come before the confirmation of the same message
+			handleReturn(ret)
+		case confirmation, ok := <-confirms:
+			if !ok {
+				// the channel was closed, whatever is left won't be confirmed
+				for _, i := range inFlight {
+					errs[i] = amqp.ErrClosed
+				}
+
+				return errs
+			}
+
+			i, ok := inFlight[confirmation.DeliveryTag]
+			if !ok {
+				continue
+			}
+
+			delete(inFlight, confirmation.DeliveryTag)
+
+			if !confirmation.Ack {
+				errs[i] = errNacked
+			}
+		case <-timer.C:
+			for _, i := range inFlight {
+				errs[i] = errNotConfirmed
+			}
+
+			return errs
+		}
+	}
+
+	// a return may still be buffered if the confirmation was read first
+	for drained := false; !drained; {
+		select {
+		case ret := <-returns:
+			handleReturn(ret)
+		default:
+			drained = true
+		}
+	}
+
+	return errs
+}
+
+func (bus *AMQPBus) Subscribe(config QueueConfig, consumerName string, handler func(*Delivery)) (Subscription, error) {
+	return newAMQPSubscription(config, consumerName, handler)
+}
+
+func (bus *AMQPBus) Health() BusHealth {
+	return bus.connection.Health()
+}
+
+func (bus *AMQPBus) Close() error {
+	return bus.connection.Close()
+}
@@ -0,0 +1,149 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"github.com/xor-shift/teleserver/util"
+	"time"
+)
+
+// BusState is the state of a Bus or a Subscription as reported by health checks
+type BusState string
+
+const (
+	BusConnecting BusState = "connecting"
+	BusConnected  BusState = "connected"
+	BusClosed     BusState = "closed"
+)
+
+// BusHealth describes the state of the connection of a Bus or a Subscription
+type BusHealth struct {
+	State      BusState  `json:"state"`
+	Since      time.Time `json:"since"`
+	Reconnects uint      `json:"reconnects"`
+	LastError  string    `json:"lastError,omitempty"`
+}
+
+// ErrBusClosed is returned by the operations of a Bus that was closed
+var ErrBusClosed = errors.New("the bus is closed")
+
+// Message is a packet travelling on a Bus
+type Message struct {
+	RoutingKey  string
+	ContentType string
+	Headers     map[string]any
+	Body        []byte
+}
+
+// Delivery is a message received through a Subscription.
+//
+// Every delivery must be either acked or failed exactly once, not necessarily before the next one is received. Failed
+// deliveries are retried up to a number of times with an exponential backoff and dead-lettered afterwards, or right
+// away if the error is Permanent.
+type Delivery struct {
+	Message
+
+	// Retries is the number of times the delivery failed before
+	Retries uint
+
+	ack  func() error
+	fail func(err error) error
+}
+
+// Ack tells the bus that the delivery was processed
+func (delivery *Delivery) Ack() error {
+	return delivery.ack()
+}
+
+// Fail tells the bus that the delivery couldn't be processed because of `err`
+func (delivery *Delivery) Fail(err error) error {
+	return delivery.fail(err)
+}
+
+// Bus carries packets from the producer to the consumers. Messages are published to PacketExchange and routed to the
+// queues of the subscriptions by their routing keys.
+type Bus interface {
+	// Publish publishes messages to PacketExchange. The returned slice holds the outcome of every message, nil meaning
+	// that the bus took responsibility for the message and routed it to at least one queue.
+	//
+	// Must not be called concurrently.
+	Publish(messages []Message) []error
+
+	// Subscribe declares the queue described by `config` and passes its deliveries to `handler` one by one until the
+	// subscription is shut down
+	Subscribe(config QueueConfig, consumerName string, handler func(*Delivery)) (Subscription, error)
+
+	// Health describes the connection that messages are published through
+	Health() BusHealth
+
+	Close() error
+}
+
+// Subscription is the consumption of a queue of a Bus
+type Subscription interface {
+	Health() BusHealth
+
+	// Stop stops the deliveries and waits for the handler to return for the ones that were already received. They can
+	// still be acked or failed until the subscription is closed.
+	Stop(ctx context.Context) error
+
+	// Close releases the subscription, deliveries that weren't acked or failed yet are delivered again
+	Close() error
+}
+
+// ShutdownSubscription stops a subscription and closes it, even if `ctx` expires before the handler returns
+func ShutdownSubscription(ctx context.Context, subscription Subscription) error {
+	stopErr := subscription.Stop(ctx)
+	closeErr := subscription.Close()
+
+	if stopErr != nil {
+		return stopErr
+	}
+
+	return closeErr
+}
+
+// AckingHandler adapts a function that processes deliveries to a Subscription handler. Deliveries are acked if the
+// function succeeds and failed with its error otherwise.
+func AckingHandler(process func(*Delivery) error) func(*Delivery) {
+	return func(delivery *Delivery) {
+		if err := process(delivery); err != nil {
+			_ = delivery.Fail(err)
+			return
+		}
+
+		_ = delivery.Ack()
+	}
+}
+
+// retryPolicy tells how many times and after how long failed deliveries are retried
+type retryPolicy struct {
+	maxRetries uint
+	retryDelay time.Duration
+}
+
+// retryPolicyFromEnv reads AMQP_MAX_RETRIES (5) and AMQP_RETRY_DELAY (1s), the delay doubles with every retry
+func retryPolicyFromEnv() (retryPolicy, error) {
+	var err error
+	var policy retryPolicy
+
+	if policy.maxRetries, err = util.GetenvUint("AMQP_MAX_RETRIES", 5); err != nil {
+		return retryPolicy{}, err
+	}
+
+	if policy.retryDelay, err = util.GetenvDuration("AMQP_RETRY_DELAY", time.Second); err != nil {
+		return retryPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// delay returns how long to wait before retrying a delivery that already failed `retries` times, and false if it
+// shouldn't be retried anymore
+func (policy retryPolicy) delay(retries uint, err error) (time.Duration, bool) {
+	if IsPermanent(err) || retries >= policy.maxRetries {
+		return 0, false
+	}
+
+	return policy.retryDelay << retries, true
+}
@@ -0,0 +1,251 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"github.com/streadway/amqp"
+	"github.com/xor-shift/teleserver/util"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrAMQPNotConnected is returned by AMQPConnection.Channel while the connection is down
+var ErrAMQPNotConnected = errors.New("not connected to the amqp broker")
+
+// AMQPConnection is a connection to the broker at AMQP_URL with a single channel that is re-established with an
+// exponential backoff whenever either of them is closed.
+//
+// `setup` is called on every new channel before it's handed out and should declare the topology the user of the
+// connection relies on.
+type AMQPConnection struct {
+	url   string
+	setup func(*amqp.Channel) error
+
+	minDelay time.Duration
+	maxDelay time.Duration
+
+	// mutex guards everything below
+	mutex   *sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	health  BusHealth
+	// connected is closed once a channel is available and replaced when it's lost
+	connected chan struct{}
+
+	closing chan struct{}
+	wg      *sync.WaitGroup
+}
+
+// NewAMQPConnection starts connecting to AMQP_URL in the background.
+// The backoff between attempts starts at AMQP_RECONNECT_MIN_DELAY (500ms) and goes up to AMQP_RECONNECT_MAX_DELAY
+// (30s).
+func NewAMQPConnection(setup func(*amqp.Channel) error) (*AMQPConnection, error) {
+	var err error
+
+	c := &AMQPConnection{
+		url:   util.GetenvDefault("AMQP_URL", ""),
+		setup: setup,
+
+		mutex: &sync.Mutex{},
+		health: BusHealth{
+			State: BusConnecting,
+			Since: time.Now(),
+		},
+		connected: make(chan struct{}),
+
+		closing: make(chan struct{}),
+		wg:      &sync.WaitGroup{},
+	}
+
+	if c.minDelay, err = util.GetenvDuration("AMQP_RECONNECT_MIN_DELAY", 500*time.Millisecond); err != nil {
+		return nil, err
+	}
+
+	if c.maxDelay, err = util.GetenvDuration("AMQP_RECONNECT_MAX_DELAY", 30*time.Second); err != nil {
+		return nil, err
+	}
+
+	c.wg.Add(1)
+	go c.run()
+
+	return c, nil
+}
+
+func (c *AMQPConnection) dial() (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	if c.setup != nil {
+		if err = c.setup(channel); err != nil {
+			_ = channel.Close()
+			_ = conn.Close()
+			return nil, nil, err
+		}
+	}
+
+	return conn, channel, nil
+}
+
+// backoff waits for about `delay`, returning false if the connection was closed in the meantime
+func (c *AMQPConnection) backoff(delay time.Duration) bool {
+	// up to 20% of jitter so that services don't reconnect in lockstep after a broker restart
+	jittered := delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+
+	timer := time.NewTimer(jittered)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-c.closing:
+		return false
+	}
+}
+
+func (c *AMQPConnection) run() {
+	defer c.wg.Done()
+
+	delay := c.minDelay
+
+	for {
+		conn, channel, err := c.dial()
+		if err != nil {
+			c.setError(err)
+			log.Printf("failed to connect to the amqp broker, retrying in %s: %s", delay, err)
+
+			if !c.backoff(delay) {
+				c.setClosed()
+				return
+			}
+
+			if delay *= 2; delay > c.maxDelay {
+				delay = c.maxDelay
+			}
+
+			continue
+		}
+
+		delay = c.minDelay
+
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+		c.setConnected(conn, channel)
+		log.Printf("connected to the amqp broker")
+
+		var amqpErr *amqp.Error
+
+		select {
+		case amqpErr = <-connClosed:
+		case amqpErr = <-channelClosed:
+		case <-c.closing:
+			c.setClosed()
+			_ = channel.Close()
+			_ = conn.Close()
+			return
+		}
+
+		if amqpErr == nil {
+			amqpErr = amqp.ErrClosed
+		}
+
+		c.setDisconnected(amqpErr)
+		log.Printf("lost the connection to the amqp broker: %s", amqpErr)
+
+		_ = conn.Close()
+	}
+}
+
+func (c *AMQPConnection) setConnected(conn *amqp.Connection, channel *amqp.Channel) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.conn = conn
+	c.channel = channel
+	c.health.State = BusConnected
+	c.health.Since = time.Now()
+	close(c.connected)
+}
+
+func (c *AMQPConnection) setDisconnected(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.conn = nil
+	c.channel = nil
+	c.health.State = BusConnecting
+	c.health.Since = time.Now()
+	c.health.Reconnects++
+	c.health.LastError = err.Error()
+	c.connected = make(chan struct{})
+}
+
+func (c *AMQPConnection) setError(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.health.LastError = err.Error()
+}
+
+func (c *AMQPConnection) setClosed() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.conn = nil
+	c.channel = nil
+	c.health.State = BusClosed
+	c.health.Since = time.Now()
+}
+
+// Channel returns the current channel, or ErrAMQPNotConnected if the connection is down
+func (c *AMQPConnection) Channel() (*amqp.Channel, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.channel == nil {
+		return nil, ErrAMQPNotConnected
+	}
+
+	return c.channel, nil
+}
+
+// WaitConnected waits for the connection to be up
+func (c *AMQPConnection) WaitConnected(ctx context.Context) error {
+	c.mutex.Lock()
+	connected := c.connected
+	c.mutex.Unlock()
+
+	select {
+	case <-connected:
+		return nil
+	case <-c.closing:
+		return amqp.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *AMQPConnection) Health() BusHealth {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.health
+}
+
+// Close closes the connection and stops reconnecting
+func (c *AMQPConnection) Close() error {
+	close(c.closing)
+	c.wg.Wait()
+
+	return nil
+}
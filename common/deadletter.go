@@ -0,0 +1,117 @@
+package common
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"time"
+)
+
+const (
+	// DeadLetterExchange is where consumers publish the deliveries they gave up on
+	DeadLetterExchange = "telemetry.dead"
+	// DeadLetterQueue holds dead-lettered deliveries until they're inspected and requeued
+	DeadLetterQueue = "telemetry.dead"
+
+	// HeaderRetries is the number of times a delivery was retried
+	HeaderRetries = "x-retries"
+	// HeaderOriginalQueue is the queue that a dead-lettered delivery was consumed from
+	HeaderOriginalQueue = "x-original-queue"
+	// HeaderError is the error that got a delivery dead-lettered
+	HeaderError = "x-error"
+	// HeaderDeadLetteredAt is the unix time at which a delivery was dead-lettered
+	HeaderDeadLetteredAt = "x-dead-lettered-at"
+)
+
+type permanentError struct {
+	err error
+}
+
+func (err permanentError) Error() string { return err.err.Error() }
+func (err permanentError) Unwrap() error { return err.err }
+
+// Permanent marks an error that a Delivery is failed with as one that retrying won't fix, the delivery is
+// dead-lettered right away
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+// DeclareDeadLetters declares the dead-letter exchange and queue
+func DeclareDeadLetters(amqpChan *amqp.Channel) error {
+	var err error
+
+	if err = amqpChan.ExchangeDeclare(
+		DeadLetterExchange, // name
+		"fanout",           // type
+		true,               // durable
+		false,              // auto-deleted
+		false,              // internal
+		false,              // no-wait
+		nil,                // arguments
+	); err != nil {
+		return err
+	}
+
+	if _, err = amqpChan.QueueDeclare(
+		DeadLetterQueue, // name
+		true,            // durable
+		false,           // delete when unused
+		false,           // exclusive
+		false,           // no-wait
+		nil,             // arguments
+	); err != nil {
+		return err
+	}
+
+	return amqpChan.QueueBind(
+		DeadLetterQueue,    // queue name
+		"",                 // routing key
+		DeadLetterExchange, // exchange
+		false,
+		nil,
+	)
+}
+
+// DeliveryRetries returns the number of times a delivery was retried
+func DeliveryRetries(delivery *amqp.Delivery) uint {
+	switch retries := delivery.Headers[HeaderRetries].(type) {
+	case int32:
+		return uint(retries)
+	case int64:
+		return uint(retries)
+	default:
+		return 0
+	}
+}
+
+// RepublishDelivery builds a publishing with the body and properties of a delivery and the given extra headers
+func RepublishDelivery(delivery *amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	newHeaders := amqp.Table{}
+	for k, v := range delivery.Headers {
+		newHeaders[k] = v
+	}
+
+	for k, v := range headers {
+		newHeaders[k] = v
+	}
+
+	return amqp.Publishing{
+		Headers:      newHeaders,
+		ContentType:  delivery.ContentType,
+		DeliveryMode: delivery.DeliveryMode,
+		Timestamp:    delivery.Timestamp,
+		Body:         delivery.Body,
+	}
+}
+
+func deadLetterHeaders(queueName string, err error) amqp.Table {
+	return amqp.Table{
+		HeaderOriginalQueue:  queueName,
+		HeaderError:          err.Error(),
+		HeaderDeadLetteredAt: time.Now().Unix(),
+	}
+}
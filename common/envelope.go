@@ -0,0 +1,249 @@
+package common
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/streadway/amqp"
+	"reflect"
+	"regexp"
+)
+
+// PacketFormat is the encoding of the packets published to PacketExchange, it's carried in the content_type property
+// of every message
+type PacketFormat string
+
+const (
+	PacketFormatJSON PacketFormat = "application/json"
+	PacketFormatCBOR PacketFormat = "application/cbor"
+	// PacketFormatGob is the legacy, Go-only encoding of AMQPPacket. It's still decoded for the messages that were
+	// published before the envelope was introduced.
+	PacketFormatGob PacketFormat = "application/octet-stream"
+)
+
+// PacketFormatByName maps the names accepted in configuration to formats
+var PacketFormatByName = map[string]PacketFormat{
+	"json": PacketFormatJSON,
+	"cbor": PacketFormatCBOR,
+	"gob":  PacketFormatGob,
+}
+
+const (
+	// EnvelopeVersion is the version of PacketEnvelope written by this code
+	EnvelopeVersion = 1
+
+	// HeaderSchemaVersion carries the envelope version of a message
+	HeaderSchemaVersion = "x-schema-version"
+
+	PacketTypeFull       = "full"
+	PacketTypeEssentials = "essentials"
+)
+
+// genericPacketTypePattern matches the names of the types of GenericPacket, they're a word of routing keys
+var genericPacketTypePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// cborDecMode decodes the maps of unknown packet types into map[string]any, like encoding/json does, so that they can
+// be encoded as JSON again
+var cborDecMode, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+
+// PacketEnvelope is the language-neutral representation of an AMQPPacket, encoded as JSON or CBOR with the same keys:
+//
+//	{
+//	  "v": 1,                 // envelope version
+//	  "deviceId": "default",
+//	  "sessionId": 12,
+//	  "seq": 345,             // sequence id
+//	  "ts": 1680000000,       // unix time reported by the device
+//	  "rng": 123456789,       // anti-replay value
+//	  "type": "full",         // "full", "essentials" or the name of a type without a struct, see GenericPacket
+//	  "data": {...},          // the packet, keyed like the bodies that devices post
+//	  "extra": {...}          // optional, the fields of the posted packet that "data" has no key for
+//	}
+//
+// Consumers should ignore keys they don't know and refuse versions newer than the ones they do.
+type PacketEnvelope[T any] struct {
+	Version    int    `json:"v"`
+	DeviceID   string `json:"deviceId"`
+	SessionID  uint   `json:"sessionId"`
+	SequenceID uint   `json:"seq"`
+	Timestamp  int32  `json:"ts"`
+	RNGState   uint32 `json:"rng"`
+	Type       string `json:"type"`
+	Data       T      `json:"data"`
+
+	Extra map[string]any `json:"extra,omitempty"`
+}
+
+// PacketType returns the name of the type of a packet, as used in envelopes and routing keys
+func PacketType(inner InnerPacket) (string, error) {
+	switch inner := inner.(type) {
+	case FullPacket:
+		return PacketTypeFull, nil
+	case EssentialsPacket:
+		return PacketTypeEssentials, nil
+	case GenericPacket:
+		if !genericPacketTypePattern.MatchString(inner.Type) {
+			return "", errors.New(fmt.Sprintf("bad packet type \"%s\"", inner.Type))
+		}
+
+		return inner.Type, nil
+	default:
+		return "", errors.New(fmt.Sprintf("unknown packet type %T", inner))
+	}
+}
+
+// EncodeAMQPPacket encodes a packet in the given format
+func EncodeAMQPPacket(amqpPacket AMQPPacket, format PacketFormat) ([]byte, error) {
+	if format == PacketFormatGob {
+		var buffer bytes.Buffer
+		if err := gob.NewEncoder(&buffer).Encode(amqpPacket); err != nil {
+			return nil, err
+		}
+
+		return buffer.Bytes(), nil
+	}
+
+	typeName, err := PacketType(amqpPacket.Packet.Inner)
+	if err != nil {
+		return nil, err
+	}
+
+	var data any = amqpPacket.Packet.Inner
+	if generic, ok := data.(GenericPacket); ok {
+		data = generic.Data
+	}
+
+	envelope := PacketEnvelope[any]{
+		Version:    EnvelopeVersion,
+		DeviceID:   amqpPacket.DeviceID,
+		SessionID:  amqpPacket.SessionID,
+		SequenceID: amqpPacket.Packet.SequenceID,
+		Timestamp:  amqpPacket.Packet.Timestamp,
+		RNGState:   amqpPacket.Packet.RNGState,
+		Type:       typeName,
+		Data:       data,
+
+		Extra: amqpPacket.Packet.Extra,
+	}
+
+	switch format {
+	case PacketFormatJSON:
+		return json.Marshal(envelope)
+	case PacketFormatCBOR:
+		return cbor.Marshal(envelope)
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown packet format \"%s\"", format))
+	}
+}
+
+func decodeEnvelope[T any](body []byte, unmarshal func([]byte, any) error) (AMQPPacket, error) {
+	var envelope PacketEnvelope[T]
+
+	if err := unmarshal(body, &envelope); err != nil {
+		return AMQPPacket{}, err
+	}
+
+	return AMQPPacket{
+		DeviceID:  envelope.DeviceID,
+		SessionID: envelope.SessionID,
+		Packet: Packet{
+			PacketHeader: PacketHeader{
+				SequenceID: envelope.SequenceID,
+				Timestamp:  envelope.Timestamp,
+				RNGState:   envelope.RNGState,
+			},
+			Inner: envelope.Data,
+			Extra: envelope.Extra,
+		},
+	}, nil
+}
+
+// DecodeAMQPPacket decodes a packet in the given format
+func DecodeAMQPPacket(body []byte, format PacketFormat) (AMQPPacket, error) {
+	var unmarshal func([]byte, any) error
+
+	switch format {
+	case PacketFormatGob, "":
+		var amqpPacket AMQPPacket
+		err := gob.NewDecoder(bytes.NewReader(body)).Decode(&amqpPacket)
+		return amqpPacket, err
+	case PacketFormatJSON:
+		unmarshal = json.Unmarshal
+	case PacketFormatCBOR:
+		unmarshal = cborDecMode.Unmarshal
+	default:
+		return AMQPPacket{}, errors.New(fmt.Sprintf("unknown packet format \"%s\"", format))
+	}
+
+	// the version and the type are needed to know what "data" is
+	var header struct {
+		Version int    `json:"v"`
+		Type    string `json:"type"`
+	}
+
+	if err := unmarshal(body, &header); err != nil {
+		return AMQPPacket{}, err
+	}
+
+	if header.Version > EnvelopeVersion {
+		return AMQPPacket{}, errors.New(fmt.Sprintf("unsupported envelope version %d", header.Version))
+	}
+
+	switch header.Type {
+	case PacketTypeFull:
+		return decodeEnvelope[FullPacket](body, unmarshal)
+	case PacketTypeEssentials:
+		return decodeEnvelope[EssentialsPacket](body, unmarshal)
+	default:
+		if _, err := PacketType(GenericPacket{Type: header.Type}); err != nil {
+			return AMQPPacket{}, err
+		}
+
+		amqpPacket, err := decodeEnvelope[any](body, unmarshal)
+		amqpPacket.Packet.Inner = GenericPacket{Type: header.Type, Data: amqpPacket.Packet.Inner}
+
+		return amqpPacket, err
+	}
+}
+
+// NewPacketMessage encodes a packet in the given format into a message routed by PacketRoutingKey
+func NewPacketMessage(amqpPacket AMQPPacket, format PacketFormat) (Message, error) {
+	packetType, err := PacketType(amqpPacket.Packet.Inner)
+	if err != nil {
+		return Message{}, err
+	}
+
+	body, err := EncodeAMQPPacket(amqpPacket, format)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		RoutingKey:  PacketRoutingKey(amqpPacket.DeviceID, amqpPacket.SessionID, packetType),
+		ContentType: string(format),
+		Headers:     map[string]any{HeaderSchemaVersion: int32(EnvelopeVersion)},
+		Body:        body,
+	}, nil
+}
+
+// ParseMessage decodes a packet in whatever format its message carries
+func ParseMessage(message Message) (AMQPPacket, error) {
+	if version, ok := message.Headers[HeaderSchemaVersion].(int32); ok && version > EnvelopeVersion {
+		return AMQPPacket{}, errors.New(fmt.Sprintf("unsupported schema version %d", version))
+	}
+
+	return DecodeAMQPPacket(message.Body, PacketFormat(message.ContentType))
+}
+
+// ParseAMQPPacket decodes the packet of a delivery that was received straight from the broker
+func ParseAMQPPacket(delivery *amqp.Delivery) (AMQPPacket, error) {
+	return ParseMessage(Message{
+		RoutingKey:  delivery.RoutingKey,
+		ContentType: delivery.ContentType,
+		Headers:     delivery.Headers,
+		Body:        delivery.Body,
+	})
+}
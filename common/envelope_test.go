@@ -0,0 +1,102 @@
+package common
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	packets := []AMQPPacket{
+		{
+			DeviceID:  "car",
+			SessionID: 12,
+			Packet: Packet{
+				PacketHeader: PacketHeader{SequenceID: 345, Timestamp: 1680000000, RNGState: 0xDEADBEEF},
+				Inner: FullPacket{
+					BatteryVoltages: [27]float32{3.7, 3.8},
+					Speed:           42.5,
+					Gyro:            [3]float32{1, 2, 3},
+					FreeHeap:        1234,
+				},
+			},
+		},
+		{
+			DeviceID:  "car",
+			SessionID: 12,
+			Packet: Packet{
+				PacketHeader: PacketHeader{SequenceID: 346, Timestamp: 1680000001, RNGState: 1},
+				Inner: EssentialsPacket{
+					Speed:               40,
+					BatteryTemperatures: [5]float32{30, 31, 32, 33, 34},
+					Voltage:             98.5,
+					RemainingWattHours:  1000,
+				},
+			},
+		},
+	}
+
+	for _, format := range []PacketFormat{PacketFormatJSON, PacketFormatCBOR, PacketFormatGob} {
+		for _, packet := range packets {
+			body, err := EncodeAMQPPacket(packet, format)
+			if err != nil {
+				t.Fatalf("%s: %s", format, err)
+			}
+
+			decoded, err := DecodeAMQPPacket(body, format)
+			if err != nil {
+				t.Fatalf("%s: %s", format, err)
+			}
+
+			if !reflect.DeepEqual(packet, decoded) {
+				t.Fatalf("%s: expected %+v got %+v", format, packet, decoded)
+			}
+		}
+	}
+}
+
+func TestEnvelopeVersion(t *testing.T) {
+	if _, err := DecodeAMQPPacket([]byte(`{"v": 2, "type": "full", "data": {}}`), PacketFormatJSON); err == nil {
+		t.Fatalf("decoded an envelope from the future")
+	}
+}
+
+func TestEnvelopeGenericPacket(t *testing.T) {
+	body := []byte(`{"v": 1, "deviceId": "car", "sessionId": 12, "seq": 347, "ts": 1680000002, "rng": 2, "type": "imu", "data": {"accel": [1, 2.5, -3], "mode": "fast", "nested": {"ok": true}}}`)
+
+	packet, err := DecodeAMQPPacket(body, PacketFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if packetType, err := PacketType(packet.Packet.Inner); err != nil || packetType != "imu" {
+		t.Fatalf("expected an imu packet, got %+v (%v)", packet.Packet.Inner, err)
+	}
+
+	for _, format := range []PacketFormat{PacketFormatJSON, PacketFormatCBOR, PacketFormatGob} {
+		encoded, err := EncodeAMQPPacket(packet, format)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		decoded, err := DecodeAMQPPacket(encoded, format)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		// CBOR keeps integers as integers, compare the JSON encodings
+		expected, _ := json.Marshal(packet)
+		got, err := json.Marshal(decoded)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		if string(expected) != string(got) {
+			t.Fatalf("%s: expected %s got %s", format, expected, got)
+		}
+	}
+
+	if _, err = DecodeAMQPPacket([]byte(`{"v": 1, "type": "a.b", "data": {}}`), PacketFormatJSON); err == nil {
+		t.Fatalf("decoded a packet type that isn't a routing key word")
+	}
+}
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"context"
+	"github.com/xor-shift/teleserver/util"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ShutdownSignalContext returns a context that is cancelled once the process receives a SIGINT or a SIGTERM
+func ShutdownSignalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// ShutdownContext returns the context that a service has for draining and cleaning up after a shutdown signal, it
+// expires after SHUTDOWN_TIMEOUT (10s by default)
+func ShutdownContext() (context.Context, context.CancelFunc) {
+	timeout, err := util.GetenvDuration("SHUTDOWN_TIMEOUT", 10*time.Second)
+	if err != nil {
+		log.Printf("%s, using the default shutdown timeout", err)
+		timeout = 10 * time.Second
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// WaitContext waits for `wait` to return or for `ctx` to expire, whichever comes first
+func WaitContext(ctx context.Context, wait func()) error {
+	done := make(chan struct{})
+
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
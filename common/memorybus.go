@@ -0,0 +1,417 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryBus is a Bus that keeps its queues in memory. It connects the publishers and subscribers of a single process
+// without a broker, e.g. to run the whole pipeline in a test.
+//
+// Queues are bound to PacketExchange with topic patterns, share their deliveries between the subscriptions that consume
+// them and honor the prefetch count of their QueueConfig. Failed deliveries end up in DeadLetterQueue once they run out
+// of retries. The other settings of a QueueConfig are ignored.
+type MemoryBus struct {
+	retryPolicy retryPolicy
+	since       time.Time
+
+	// mutex guards everything below
+	mutex       *sync.Mutex
+	queues      map[string]*memoryQueue
+	bindings    []memoryBinding
+	nextQueueID uint
+	closed      bool
+}
+
+type memoryBinding struct {
+	pattern string
+	queue   *memoryQueue
+}
+
+type memoryMessage struct {
+	message Message
+	retries uint
+}
+
+type memoryQueue struct {
+	name string
+
+	// mutex guards messages
+	mutex    *sync.Mutex
+	messages []memoryMessage
+	// ready holds a value whenever messages may not be empty
+	ready chan struct{}
+}
+
+// NewMemoryBus creates an empty bus, failed deliveries are retried up to `maxRetries` times with a delay starting at
+// `retryDelay` and doubling with every retry
+func NewMemoryBus(maxRetries uint, retryDelay time.Duration) *MemoryBus {
+	return &MemoryBus{
+		retryPolicy: retryPolicy{
+			maxRetries: maxRetries,
+			retryDelay: retryDelay,
+		},
+		since: time.Now(),
+
+		mutex:  &sync.Mutex{},
+		queues: map[string]*memoryQueue{},
+	}
+}
+
+// topicMatches tells whether a routing key matches the binding pattern of a topic exchange, "*" standing for exactly
+// one word and "#" for zero or more words
+func topicMatches(pattern string, routingKey string) bool {
+	return wordsMatch(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func wordsMatch(pattern []string, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if wordsMatch(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+
+		return false
+	case "*":
+		return len(words) != 0 && wordsMatch(pattern[1:], words[1:])
+	default:
+		return len(words) != 0 && words[0] == pattern[0] && wordsMatch(pattern[1:], words[1:])
+	}
+}
+
+// push appends a message to the queue
+func (queue *memoryQueue) push(message Message, retries uint) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.messages = append(queue.messages, memoryMessage{
+		message: message,
+		retries: retries,
+	})
+
+	select {
+	case queue.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop takes the oldest message out of the queue
+func (queue *memoryQueue) pop() (memoryMessage, bool) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if len(queue.messages) == 0 {
+		return memoryMessage{}, false
+	}
+
+	message := queue.messages[0]
+	queue.messages = queue.messages[1:]
+
+	// wake up the other subscriptions of the queue
+	if len(queue.messages) != 0 {
+		select {
+		case queue.ready <- struct{}{}:
+		default:
+		}
+	}
+
+	return message, true
+}
+
+// next waits for a message, it returns false if `stopping` is closed first
+func (queue *memoryQueue) next(stopping <-chan struct{}) (memoryMessage, bool) {
+	for {
+		if message, ok := queue.pop(); ok {
+			return message, true
+		}
+
+		select {
+		case <-queue.ready:
+		case <-stopping:
+			return memoryMessage{}, false
+		}
+	}
+}
+
+// declareQueue returns the queue described by `config`, creating and binding it if needed. Must be called with the
+// mutex held.
+func (bus *MemoryBus) declareQueue(config QueueConfig) *memoryQueue {
+	name := config.Queue
+	if name == "" {
+		bus.nextQueueID++
+		name = fmt.Sprintf("amq.gen-%d", bus.nextQueueID)
+	}
+
+	queue, ok := bus.queues[name]
+	if !ok {
+		queue = &memoryQueue{
+			name: name,
+
+			mutex: &sync.Mutex{},
+			ready: make(chan struct{}, 1),
+		}
+
+		bus.queues[name] = queue
+	}
+
+	if config.Exchange != PacketExchange {
+		return queue
+	}
+
+	for _, pattern := range config.bindings() {
+		bound := false
+		for _, binding := range bus.bindings {
+			bound = bound || (binding.queue == queue && binding.pattern == pattern)
+		}
+
+		if !bound {
+			bus.bindings = append(bus.bindings, memoryBinding{pattern: pattern, queue: queue})
+		}
+	}
+
+	return queue
+}
+
+func (bus *MemoryBus) Publish(messages []Message) []error {
+	errs := make([]error, len(messages))
+
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	for i, message := range messages {
+		if bus.closed {
+			errs[i] = ErrBusClosed
+			continue
+		}
+
+		routed := map[*memoryQueue]bool{}
+		for _, binding := range bus.bindings {
+			if !routed[binding.queue] && topicMatches(binding.pattern, message.RoutingKey) {
+				routed[binding.queue] = true
+				binding.queue.push(message, 0)
+			}
+		}
+
+		if len(routed) == 0 {
+			errs[i] = errors.New(fmt.Sprintf("no queue is bound to \"%s\"", message.RoutingKey))
+		}
+	}
+
+	return errs
+}
+
+// deadLetter puts a message that failed for good in DeadLetterQueue with the same headers as the AMQP bus adds
+func (bus *MemoryBus) deadLetter(message Message, queueName string, err error) {
+	headers := map[string]any{}
+	for k, v := range message.Headers {
+		headers[k] = v
+	}
+
+	for k, v := range deadLetterHeaders(queueName, err) {
+		headers[k] = v
+	}
+
+	message.Headers = headers
+
+	bus.mutex.Lock()
+	queue := bus.declareQueue(QueueConfig{
+		Exchange: DeadLetterExchange,
+		Queue:    DeadLetterQueue,
+	})
+	bus.mutex.Unlock()
+
+	queue.push(message, 0)
+}
+
+func (bus *MemoryBus) Subscribe(config QueueConfig, consumerName string, handler func(*Delivery)) (Subscription, error) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	if bus.closed {
+		return nil, ErrBusClosed
+	}
+
+	queue := bus.declareQueue(config)
+
+	subscription := &memorySubscription{
+		bus:     bus,
+		queue:   queue,
+		handler: handler,
+
+		stopping: make(chan struct{}),
+		wg:       &sync.WaitGroup{},
+
+		mutex:     &sync.Mutex{},
+		unsettled: map[uint64]memoryMessage{},
+	}
+
+	if config.Prefetch != 0 {
+		subscription.inFlight = make(chan struct{}, config.Prefetch)
+	}
+
+	subscription.wg.Add(1)
+	go subscription.run()
+
+	return subscription, nil
+}
+
+func (bus *MemoryBus) Health() BusHealth {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	health := BusHealth{
+		State: BusConnected,
+		Since: bus.since,
+	}
+
+	if bus.closed {
+		health.State = BusClosed
+	}
+
+	return health
+}
+
+// Close makes further publishing and subscribing fail, the existing subscriptions keep consuming what's left in their
+// queues until they're shut down
+func (bus *MemoryBus) Close() error {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.closed = true
+
+	return nil
+}
+
+type memorySubscription struct {
+	bus     *MemoryBus
+	queue   *memoryQueue
+	handler func(*Delivery)
+
+	// inFlight holds a value for every delivery that wasn't acked or failed yet, it's nil if there's no prefetch limit
+	inFlight chan struct{}
+
+	stopping chan struct{}
+	wg       *sync.WaitGroup
+
+	// mutex guards everything below
+	mutex *sync.Mutex
+	// unsettled holds the deliveries that weren't acked or failed yet by their ids
+	unsettled map[uint64]memoryMessage
+	nextID    uint64
+	closed    bool
+}
+
+func (subscription *memorySubscription) run() {
+	defer subscription.wg.Done()
+
+	for {
+		if subscription.inFlight != nil {
+			select {
+			case subscription.inFlight <- struct{}{}:
+			case <-subscription.stopping:
+				return
+			}
+		}
+
+		message, ok := subscription.queue.next(subscription.stopping)
+		if !ok {
+			return
+		}
+
+		subscription.handler(subscription.delivery(message))
+	}
+}
+
+func (subscription *memorySubscription) delivery(queued memoryMessage) *Delivery {
+	subscription.mutex.Lock()
+	id := subscription.nextID
+	subscription.nextID++
+	subscription.unsettled[id] = queued
+	subscription.mutex.Unlock()
+
+	settle := func() error {
+		subscription.mutex.Lock()
+		defer subscription.mutex.Unlock()
+
+		if subscription.closed {
+			return ErrBusClosed
+		}
+
+		if _, ok := subscription.unsettled[id]; !ok {
+			return errors.New("the delivery was already acked or failed")
+		}
+
+		delete(subscription.unsettled, id)
+
+		if subscription.inFlight != nil {
+			<-subscription.inFlight
+		}
+
+		return nil
+	}
+
+	return &Delivery{
+		Message: queued.message,
+		Retries: queued.retries,
+
+		ack: settle,
+		fail: func(err error) error {
+			if settleErr := settle(); settleErr != nil {
+				return settleErr
+			}
+
+			queueName := subscription.queue.name
+
+			delay, retry := subscription.bus.retryPolicy.delay(queued.retries, err)
+			if !retry {
+				log.Printf("dead-lettering a delivery from %s after %d retries: %s", queueName, queued.retries, err)
+				subscription.bus.deadLetter(queued.message, queueName, err)
+				return nil
+			}
+
+			log.Printf("failed to process a delivery from %s (retry %d/%d in %s): %s", queueName, queued.retries+1, subscription.bus.retryPolicy.maxRetries, delay, err)
+
+			time.AfterFunc(delay, func() {
+				subscription.queue.push(queued.message, queued.retries+1)
+			})
+
+			return nil
+		},
+	}
+}
+
+func (subscription *memorySubscription) Health() BusHealth {
+	return subscription.bus.Health()
+}
+
+func (subscription *memorySubscription) Stop(ctx context.Context) error {
+	close(subscription.stopping)
+
+	return WaitContext(ctx, subscription.wg.Wait)
+}
+
+// Close puts the deliveries that weren't acked or failed back in the queue
+func (subscription *memorySubscription) Close() error {
+	subscription.mutex.Lock()
+	subscription.closed = true
+	unsettled := subscription.unsettled
+	subscription.unsettled = nil
+	subscription.mutex.Unlock()
+
+	for _, queued := range unsettled {
+		subscription.queue.push(queued.message, queued.retries)
+	}
+
+	return nil
+}
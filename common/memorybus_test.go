@@ -0,0 +1,118 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestTopicMatches(t *testing.T) {
+	cases := []struct {
+		pattern    string
+		routingKey string
+		expected   bool
+	}{
+		{"#", "telemetry.a.1.full", true},
+		{"telemetry.*.*.full", "telemetry.a.1.full", true},
+		{"telemetry.*.*.full", "telemetry.a.1.essentials", false},
+		{"telemetry.a.#", "telemetry.a.1.full", true},
+		{"telemetry.a.#", "telemetry.a", true},
+		{"telemetry.#.full", "telemetry.a.1.full", true},
+		{"telemetry.*", "telemetry.a.1.full", false},
+		{"telemetry.*.1.*", "telemetry.b.10.full", false},
+	}
+
+	for _, c := range cases {
+		if got := topicMatches(c.pattern, c.routingKey); got != c.expected {
+			t.Errorf("%s against %s: expected %t got %t", c.routingKey, c.pattern, c.expected, got)
+		}
+	}
+}
+
+func TestMemoryBusRetries(t *testing.T) {
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(output)
+
+	bus := NewMemoryBus(2, time.Millisecond)
+	defer bus.Close()
+
+	attempts := make(chan uint, 8)
+	subscription, err := bus.Subscribe(QueueConfig{Exchange: PacketExchange, Queue: "test"}, "test", func(delivery *Delivery) {
+		attempts <- delivery.Retries
+		_ = delivery.Fail(errors.New("failed"))
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetters := make(chan *Delivery, 1)
+	deadLetterSubscription, err := bus.Subscribe(QueueConfig{Exchange: DeadLetterExchange, Queue: DeadLetterQueue}, "test", func(delivery *Delivery) {
+		_ = delivery.Ack()
+		deadLetters <- delivery
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := bus.Publish([]Message{{RoutingKey: "telemetry.a.1.full", Body: []byte("test")}}); errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+
+	for expected := uint(0); expected <= 2; expected++ {
+		if got := <-attempts; got != expected {
+			t.Fatalf("expected retry %d got %d", expected, got)
+		}
+	}
+
+	deadLetter := <-deadLetters
+	if string(deadLetter.Body) != "test" || deadLetter.Headers[HeaderOriginalQueue] != "test" {
+		t.Fatalf("unexpected dead letter %+v", deadLetter)
+	}
+
+	for _, s := range []Subscription{subscription, deadLetterSubscription} {
+		if err = ShutdownSubscription(context.Background(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// subscriptions don't get more deliveries than their prefetch count until they ack some of them
+func TestMemoryBusPrefetch(t *testing.T) {
+	bus := NewMemoryBus(0, 0)
+	defer bus.Close()
+
+	deliveries := make(chan *Delivery, 8)
+	subscription, err := bus.Subscribe(QueueConfig{Exchange: PacketExchange, Prefetch: 2}, "test", func(delivery *Delivery) {
+		deliveries <- delivery
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Publish(make([]Message, 4))
+
+	first, second := <-deliveries, <-deliveries
+
+	select {
+	case <-deliveries:
+		t.Fatal("got a delivery over the prefetch count")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	_ = first.Ack()
+	_ = second.Ack()
+
+	<-deliveries
+	<-deliveries
+
+	if err = ShutdownSubscription(context.Background(), subscription); err != nil {
+		t.Fatal(err)
+	}
+}
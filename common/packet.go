@@ -55,6 +55,18 @@ type FullPacket struct {
 	CPUUsage        float32 `json:"cu" mapstructure:"cu"`
 }
 
+// GenericPacket is a packet of a type that has no struct of its own. Its data is kept as it was decoded from the
+// envelope so that new or experimental packet types can be forwarded and stored before they get a typed mapping.
+type GenericPacket struct {
+	Type string
+	Data any
+}
+
+// MarshalJSON encodes the data of the packet without wrapping it
+func (packet GenericPacket) MarshalJSON() ([]byte, error) {
+	return json.Marshal(packet.Data)
+}
+
 type PacketHeader struct {
 	SequenceID uint   `json:"seq"`
 	Timestamp  int32  `json:"ts"`
@@ -65,9 +77,38 @@ type Packet struct {
 	PacketHeader
 
 	Inner InnerPacket `json:"data"`
+
+	// Extra holds the fields of the object posted by the device that Inner has no field for, so that new firmware
+	// fields are kept until they get a mapping
+	Extra map[string]any `json:"extra,omitempty"`
+}
+
+// DataJSON returns the data of a packet as JSON with its extra fields merged in, i.e. the object the device posted
+func (packet Packet) DataJSON() ([]byte, error) {
+	data, err := json.Marshal(packet.Inner)
+	if err != nil || len(packet.Extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]any
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for key, value := range packet.Extra {
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+
+	return json.Marshal(fields)
 }
 
+// DefaultDeviceID is the device that requests without an explicit device identifier are attributed to.
+const DefaultDeviceID = "default"
+
 type AMQPPacket struct {
+	DeviceID  string `json:"deviceId"`
 	SessionID uint   `json:"sessionId"`
 	Packet    Packet `json:"packet"`
 }
@@ -75,6 +116,9 @@ type AMQPPacket struct {
 func init() {
 	gob.Register(EssentialsPacket{})
 	gob.Register(FullPacket{})
+	gob.Register(GenericPacket{})
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
 
 	/*gob.RegisterName("EssentialsPacket", EssentialsPacket{})
 	gob.RegisterName("FullPacket", FullPacket{})
@@ -83,7 +127,12 @@ func init() {
 	gob.RegisterName("AMQPPacket", AMQPPacket{})*/
 }
 
-func ParsePackets[T EssentialsPacket | FullPacket](body []byte, pubKey ecdsa.PublicKey) (packets []Packet, err error) {
+// ErrBadSignature is returned by ParsePackets for bodies whose signature doesn't match
+var ErrBadSignature = errors.New("bad signature")
+
+// parseSignedPackets verifies the signature at the end of a body and decodes the packets before it, leaving their data
+// as decoded from JSON
+func parseSignedPackets(body []byte, pubKey ecdsa.PublicKey) (packets []Packet, err error) {
 	if len(body) < 128+2 {
 		err = errors.New("body is too small even for an empty object and a signature")
 		return
@@ -111,11 +160,17 @@ func ParsePackets[T EssentialsPacket | FullPacket](body []byte, pubKey ecdsa.Pub
 	jsonHash := sha256.Sum256(jsonBody)
 
 	if !ecdsa.Verify(&pubKey, jsonHash[:], r, s) {
-		err = errors.New("bad signature")
+		err = ErrBadSignature
 		return
 	}
 
-	if err = json.Unmarshal(jsonBody, &packets); err != nil {
+	err = json.Unmarshal(jsonBody, &packets)
+
+	return
+}
+
+func ParsePackets[T EssentialsPacket | FullPacket](body []byte, pubKey ecdsa.PublicKey) (packets []Packet, err error) {
+	if packets, err = parseSignedPackets(body, pubKey); err != nil {
 		return
 	}
 
@@ -127,14 +182,69 @@ func ParsePackets[T EssentialsPacket | FullPacket](body []byte, pubKey ecdsa.Pub
 		}*/
 
 		var packet T
-		err = mapstructure.Decode(v.Inner, &packet)
-		if err != nil {
+		var metadata mapstructure.Metadata
+
+		var decoder *mapstructure.Decoder
+		if decoder, err = mapstructure.NewDecoder(&mapstructure.DecoderConfig{Metadata: &metadata, Result: &packet}); err != nil {
+			return
+		}
+
+		if err = decoder.Decode(v.Inner); err != nil {
 			err = errors.New(fmt.Sprintf("packet at index %d was not of the correct type", k))
 			return
 		}
 
 		packets[k].Inner = packet
+		packets[k].Extra = unmappedFields(v.Inner, metadata.Unused)
 	}
 
 	return
 }
+
+// unmappedFields returns the top level fields of `data` among the `unused` keys reported by mapstructure, or nil
+func unmappedFields(data any, unused []string) map[string]any {
+	fields, ok := data.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	var extra map[string]any
+
+	for _, key := range unused {
+		if value, ok := fields[key]; ok {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+
+			extra[key] = value
+		}
+	}
+
+	return extra
+}
+
+// ParseGenericPackets returns a parser like ParsePackets for the packets of a type that has no struct of its own, whose
+// data is kept as posted in a GenericPacket
+func ParseGenericPackets(packetType string) func(body []byte, pubKey ecdsa.PublicKey) ([]Packet, error) {
+	return func(body []byte, pubKey ecdsa.PublicKey) ([]Packet, error) {
+		if _, err := PacketType(GenericPacket{Type: packetType}); err != nil {
+			return nil, err
+		}
+
+		packets, err := parseSignedPackets(body, pubKey)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range packets {
+			if _, ok := v.Inner.(map[string]any); !ok {
+				return nil, errors.New(fmt.Sprintf("packet at index %d has no data object", k))
+			}
+
+			packets[k].Inner = GenericPacket{Type: packetType, Data: v.Inner}
+			packets[k].Extra = nil
+		}
+
+		return packets, nil
+	}
+}
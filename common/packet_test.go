@@ -0,0 +1,94 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// signBody signs a JSON body the way devices do, appending the hex encoded R and S
+func signBody(t *testing.T, key *ecdsa.PrivateKey, body string) []byte {
+	hash := sha256.Sum256([]byte(body))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []byte(fmt.Sprintf("%s%064x%064x", body, r, s))
+}
+
+// the fields that a packet struct has no field for are kept up to the JSON that consumer_db writes to packets_json
+func TestUnmappedFields(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := signBody(t, key, `[{"seq": 1, "ts": 1680000000, "rng": 2, "data": {"spd": 42, "v": 98.5, "coolant": 71.5}}]`)
+
+	packets, err := ParsePackets[EssentialsPacket](body, key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if packets[0].Inner.(EssentialsPacket).Speed != 42 || packets[0].Extra["coolant"] != 71.5 {
+		t.Fatalf("unexpected packet %+v", packets[0])
+	}
+
+	for _, format := range []PacketFormat{PacketFormatJSON, PacketFormatCBOR, PacketFormatGob} {
+		encoded, err := EncodeAMQPPacket(AMQPPacket{DeviceID: "car", SessionID: 1, Packet: packets[0]}, format)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		decoded, err := DecodeAMQPPacket(encoded, format)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		data, err := decoded.Packet.DataJSON()
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		var fields map[string]any
+		if err = json.Unmarshal(data, &fields); err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		if fields["coolant"] != 71.5 || fields["spd"] != 42.0 {
+			t.Fatalf("%s: unexpected data %s", format, data)
+		}
+	}
+}
+
+func TestParseGenericPackets(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := signBody(t, key, `[{"seq": 1, "ts": 1680000000, "rng": 2, "data": {"accel": [1, 2, 3]}}]`)
+
+	packets, err := ParseGenericPackets("imu")(body, key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if generic, ok := packets[0].Inner.(GenericPacket); !ok || generic.Type != "imu" {
+		t.Fatalf("unexpected packet %+v", packets[0])
+	}
+
+	if data, _ := packets[0].DataJSON(); string(data) != `{"accel":[1,2,3]}` {
+		t.Fatalf("unexpected data %s", data)
+	}
+
+	if _, err = ParseGenericPackets("a.b")(body, key.PublicKey); err == nil {
+		t.Fatalf("parsed packets of a type that isn't a routing key word")
+	}
+}
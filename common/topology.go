@@ -0,0 +1,183 @@
+package common
+
+import (
+	"fmt"
+	"github.com/streadway/amqp"
+	"github.com/xor-shift/teleserver/util"
+	"strings"
+	"time"
+)
+
+const (
+	// PacketExchange is the topic exchange that ingest publishes packets to with the routing keys built by
+	// PacketRoutingKey. It replaces the "full_packets" fanout exchange, which can't be redeclared as a topic exchange.
+	PacketExchange     = "telemetry"
+	PacketExchangeType = "topic"
+)
+
+// PacketRoutingKey returns the routing key of a packet, "telemetry.<device>.<session>.<packet type>"
+func PacketRoutingKey(deviceID string, sessionID uint, packetType string) string {
+	return fmt.Sprintf("telemetry.%s.%d.%s", deviceID, sessionID, packetType)
+}
+
+// PacketBindingPattern returns a binding pattern for the packets of a device (or of every device if it's empty) of
+// the given type (or of every type if it's empty), e.g. "telemetry.*.*.essentials"
+func PacketBindingPattern(deviceID string, packetType string) string {
+	if deviceID == "" {
+		deviceID = "*"
+	}
+
+	if packetType == "" {
+		packetType = "*"
+	}
+
+	return fmt.Sprintf("telemetry.%s.*.%s", deviceID, packetType)
+}
+
+// declarePacketExchange declares the exchange that packets are published to
+func declarePacketExchange(amqpChan *amqp.Channel) error {
+	return amqpChan.ExchangeDeclare(
+		PacketExchange,     // name
+		PacketExchangeType, // type
+		true,               // durable
+		false,              // auto-deleted
+		false,              // internal
+		false,              // no-wait
+		nil,                // arguments
+	)
+}
+
+// QueueConfig describes the queue of a Subscription and how it's bound to the packet exchange.
+//
+// Several consumers that share a durable, non-exclusive queue compete for its deliveries, every packet ends up with
+// exactly one of them. Consumers with their own (e.g. server-named exclusive) queues all get every packet.
+type QueueConfig struct {
+	Exchange     string
+	ExchangeType string
+
+	// Queue is the name of the queue, the broker picks a name if it's empty
+	Queue      string
+	Durable    bool
+	Exclusive  bool
+	AutoDelete bool
+
+	// Prefetch is the number of unacked deliveries the broker sends to a consumer at once
+	Prefetch uint
+	// MessageTTL is how long a packet can wait in the queue before it's dropped, 0 for no limit
+	MessageTTL time.Duration
+	// MaxLength is the number of packets the queue can hold before the oldest ones are dropped, 0 for no limit
+	MaxLength uint
+
+	// Bindings are the patterns the queue is bound with, see PacketBindingPattern. Every packet is delivered if it's
+	// empty.
+	Bindings []string
+}
+
+// QueueConfigFromEnv overrides the fields of `def` with the environment variables starting with `prefix`:
+// <prefix>_QUEUE, <prefix>_QUEUE_DURABLE, <prefix>_QUEUE_EXCLUSIVE, <prefix>_QUEUE_AUTO_DELETE, <prefix>_PREFETCH,
+// <prefix>_MESSAGE_TTL, <prefix>_MAX_LENGTH and <prefix>_BINDINGS (comma separated, e.g.
+// "telemetry.car1.*.*,telemetry.*.*.essentials").
+func QueueConfigFromEnv(prefix string, def QueueConfig) (QueueConfig, error) {
+	var err error
+
+	config := def
+	config.Queue = util.GetenvDefault(prefix+"_QUEUE", def.Queue)
+
+	if config.Durable, err = util.GetenvBool(prefix+"_QUEUE_DURABLE", def.Durable); err != nil {
+		return QueueConfig{}, err
+	}
+
+	if config.Exclusive, err = util.GetenvBool(prefix+"_QUEUE_EXCLUSIVE", def.Exclusive); err != nil {
+		return QueueConfig{}, err
+	}
+
+	if config.AutoDelete, err = util.GetenvBool(prefix+"_QUEUE_AUTO_DELETE", def.AutoDelete); err != nil {
+		return QueueConfig{}, err
+	}
+
+	if config.Prefetch, err = util.GetenvUint(prefix+"_PREFETCH", def.Prefetch); err != nil {
+		return QueueConfig{}, err
+	}
+
+	if config.MessageTTL, err = util.GetenvDuration(prefix+"_MESSAGE_TTL", def.MessageTTL); err != nil {
+		return QueueConfig{}, err
+	}
+
+	if config.MaxLength, err = util.GetenvUint(prefix+"_MAX_LENGTH", def.MaxLength); err != nil {
+		return QueueConfig{}, err
+	}
+
+	if bindings := util.GetenvDefault(prefix+"_BINDINGS", ""); bindings != "" {
+		config.Bindings = strings.Split(bindings, ",")
+	}
+
+	return config, nil
+}
+
+func (config QueueConfig) arguments() amqp.Table {
+	arguments := amqp.Table{}
+
+	if config.MessageTTL != 0 {
+		arguments["x-message-ttl"] = int64(config.MessageTTL / time.Millisecond)
+	}
+
+	if config.MaxLength != 0 {
+		arguments["x-max-length"] = int64(config.MaxLength)
+	}
+
+	return arguments
+}
+
+// bindings returns the binding patterns of the queue, every packet is routed to it if there are none
+func (config QueueConfig) bindings() []string {
+	if len(config.Bindings) == 0 {
+		return []string{"#"}
+	}
+
+	return config.Bindings
+}
+
+// declare declares the exchange, the queue and its bindings, returning the name of the queue.
+// Note that the broker refuses to redeclare an existing queue with different settings, such queues have to be deleted
+// first.
+func (config QueueConfig) declare(amqpChan *amqp.Channel) (string, error) {
+	var err error
+
+	if err = amqpChan.ExchangeDeclare(
+		config.Exchange,     // name
+		config.ExchangeType, // type
+		true,                // durable
+		false,               // auto-deleted
+		false,               // internal
+		false,               // no-wait
+		nil,                 // arguments
+	); err != nil {
+		return "", err
+	}
+
+	var amqpQueue amqp.Queue
+	if amqpQueue, err = amqpChan.QueueDeclare(
+		config.Queue,       // name
+		config.Durable,     // durable
+		config.AutoDelete,  // delete when unused
+		config.Exclusive,   // exclusive
+		false,              // no-wait
+		config.arguments(), // arguments
+	); err != nil {
+		return "", err
+	}
+
+	for _, routingKey := range config.bindings() {
+		if err = amqpChan.QueueBind(
+			amqpQueue.Name,  // queue name
+			routingKey,      // routing key
+			config.Exchange, // exchange
+			false,
+			nil,
+		); err != nil {
+			return "", err
+		}
+	}
+
+	return amqpQueue.Name, nil
+}
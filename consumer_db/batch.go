@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/xor-shift/teleserver/common"
+	"time"
+)
+
+// errBatcherStopped is returned by add for packets that came in after the batcher was stopped
+var errBatcherStopped = errors.New("the batcher was stopped")
+
+// batcher buffers packets and passes them to `flush` once `size` of them are buffered or `window` after the first one
+// came in, whichever comes first. Batches are flushed one at a time, packets that come in meanwhile wait in add.
+type batcher struct {
+	size   int
+	window time.Duration
+	flush  func(batch []pendingPacket)
+
+	// packets is never closed, add could be sending on it while the batcher is stopped
+	packets  chan pendingPacket
+	stopping chan struct{}
+	done     chan struct{}
+}
+
+func newBatcher(size uint, window time.Duration, flush func(batch []pendingPacket)) *batcher {
+	b := &batcher{
+		size:   int(size),
+		window: window,
+		flush:  flush,
+
+		packets:  make(chan pendingPacket),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go b.run()
+
+	return b
+}
+
+// add waits for the packet to be taken into a batch, it returns errBatcherStopped if the batcher is stopped first
+func (b *batcher) add(packet pendingPacket) error {
+	select {
+	case b.packets <- packet:
+		return nil
+	case <-b.stopping:
+		return errBatcherStopped
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+
+	var batch []pendingPacket
+	var timer *time.Timer
+	var timeout <-chan time.Time
+
+	for {
+		select {
+		case <-b.stopping:
+			if len(batch) != 0 {
+				timer.Stop()
+				b.flush(batch)
+			}
+
+			return
+		case packet := <-b.packets:
+			batch = append(batch, packet)
+
+			if len(batch) == 1 {
+				timer = time.NewTimer(b.window)
+				timeout = timer.C
+			}
+
+			if len(batch) < b.size {
+				continue
+			}
+
+			timer.Stop()
+		case <-timeout:
+		}
+
+		timeout = nil
+
+		b.flush(batch)
+		batch = nil
+	}
+}
+
+// stop flushes the packets that are left, the packets that are added afterwards are refused
+func (b *batcher) stop(ctx context.Context) error {
+	close(b.stopping)
+
+	return common.WaitContext(ctx, func() { <-b.done })
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/xor-shift/teleserver/util"
+	"log"
+)
+
+// conflictPolicy decides what happens to a packet whose key (session and sequence id) is already taken.
+//
+// Copies of a packet that was already written, e.g. redeliveries, are skipped with every policy. The other policies
+// tell these exact duplicates apart from conflicts, packets with the same key but a different payload, and record the
+// conflicts in the packet_conflicts table.
+type conflictPolicy string
+
+const (
+	// conflictIgnore keeps the row that was written first without looking at the payloads
+	conflictIgnore conflictPolicy = "ignore"
+	// conflictOverwrite replaces the row with the conflicting packet
+	conflictOverwrite conflictPolicy = "overwrite"
+	// conflictKeepFirst keeps the row that was written first and records the conflicting packet
+	conflictKeepFirst conflictPolicy = "keep_first"
+)
+
+const insertConflictQuery = "" +
+	"INSERT INTO packet_conflicts (table_name, session_id, packet_order, existing_hash, conflicting_hash, conflicting_payload, resolution" +
+	") VALUES (?, ?, ?, ?, ?, ?, ?)"
+
+// conflictPolicyFromEnv reads CONSUMER_DB_CONFLICT_POLICY
+func conflictPolicyFromEnv() (conflictPolicy, error) {
+	policy := conflictPolicy(util.GetenvDefault("CONSUMER_DB_CONFLICT_POLICY", string(conflictKeepFirst)))
+
+	switch policy {
+	case conflictIgnore, conflictOverwrite, conflictKeepFirst:
+		return policy, nil
+	default:
+		return "", errors.New(fmt.Sprintf("bad conflict policy \"%s\"", policy))
+	}
+}
+
+// resolveConflicts drops the exact duplicates out of the packets of a table and records the conflicts, returning the
+// packets that are left to be written.
+//
+// Rows aren't locked, a conflict between packets that are written at the same time by different transactions goes
+// unnoticed and the insert statement keeps or overwrites the first row as the policy says. On a hypertable, whose
+// primary key includes reported_time, both rows are kept if their reported times differ.
+func (w *writer) resolveConflicts(tx *sql.Tx, table *packetTable, packets []pendingPacket) ([]pendingPacket, error) {
+	// copies of a packet within the batch
+	var unique []pendingPacket
+	index := map[packetKey]int{}
+
+	for _, pending := range packets {
+		i, ok := index[pending.key()]
+		if !ok {
+			index[pending.key()] = len(unique)
+			unique = append(unique, pending)
+			continue
+		}
+
+		first := unique[i]
+		if first.payloadHash == pending.payloadHash {
+			continue
+		}
+
+		if w.policy == conflictOverwrite {
+			unique[i] = pending
+		}
+
+		if err := w.recordConflict(tx, table, first.payloadHash, pending); err != nil {
+			return nil, err
+		}
+	}
+
+	// packets that were written before
+	existing, err := w.existingHashes(tx, table, unique)
+	if err != nil {
+		return nil, err
+	}
+
+	var remaining []pendingPacket
+
+	for _, pending := range unique {
+		hash, ok := existing[pending.key()]
+
+		switch {
+		case !ok:
+			remaining = append(remaining, pending)
+		case hash == pending.payloadHash || hash == "":
+			// the row was either written by a copy of the packet or before the payloads were hashed, in which case
+			// there is nothing to compare it with
+		default:
+			if err = w.recordConflict(tx, table, hash, pending); err != nil {
+				return nil, err
+			}
+
+			if w.policy == conflictOverwrite {
+				remaining = append(remaining, pending)
+			}
+		}
+	}
+
+	return remaining, nil
+}
+
+// existingHashes returns the payload hashes of the rows that already exist for the keys of `packets`
+func (w *writer) existingHashes(tx *sql.Tx, table *packetTable, packets []pendingPacket) (map[packetKey]string, error) {
+	var args []any
+	for _, pending := range packets {
+		args = append(args, pending.amqpPacket.SessionID, pending.amqpPacket.Packet.SequenceID)
+	}
+
+	rows, err := w.query(tx, table.hashesQuery(len(packets)), len(packets), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	hashes := map[packetKey]string{}
+
+	for rows.Next() {
+		var key packetKey
+		var hash string
+
+		if err = rows.Scan(&key.sessionID, &key.sequenceID, &hash); err != nil {
+			return nil, err
+		}
+
+		hashes[key] = hash
+	}
+
+	return hashes, rows.Err()
+}
+
+// recordConflict records a packet whose key is already taken by a row or a packet with the hash `existingHash`
+func (w *writer) recordConflict(tx *sql.Tx, table *packetTable, existingHash string, pending pendingPacket) error {
+	resolution := "kept_first"
+	if w.policy == conflictOverwrite {
+		resolution = "overwritten"
+	}
+
+	key := pending.key()
+	log.Printf("conflicting payloads for packet %d of session %d in %s (%s)", key.sequenceID, key.sessionID, table.name, resolution)
+
+	_, err := w.exec(tx, insertConflictQuery, 1,
+		table.name, key.sessionID, key.sequenceID,
+		existingHash, pending.payloadHash, string(pending.payload), resolution,
+	)
+
+	return err
+}
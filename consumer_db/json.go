@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xor-shift/teleserver/common"
+	"github.com/xor-shift/teleserver/util"
+)
+
+// jsonStorage decides which packets are stored as JSON in packets_json, next to or instead of their typed tables
+type jsonStorage string
+
+const (
+	// jsonStorageOff stores nothing as JSON, packets of types without a table are dead-lettered
+	jsonStorageOff jsonStorage = "off"
+	// jsonStorageUnknown stores the packets of types without a table as JSON, and the packets with fields that their
+	// table has no column for next to their typed rows
+	jsonStorageUnknown jsonStorage = "unknown"
+	// jsonStorageAll stores every packet as JSON, packets of types with a table are written to both
+	jsonStorageAll jsonStorage = "all"
+)
+
+var jsonPacketTable = packetTable{
+	name: "packets_json",
+	columns: []string{
+		"session_id", "packet_order", "packet_type", "reported_time", "inner_data",
+	},
+
+	row: func(amqpPacket common.AMQPPacket) []any {
+		packet := amqpPacket.Packet
+
+		packetType, _ := common.PacketType(packet.Inner)
+		innerData, _ := packet.DataJSON()
+
+		return []any{
+			amqpPacket.SessionID, packet.SequenceID, packetType, packet.Timestamp, string(innerData),
+		}
+	},
+}
+
+// jsonStorageFromEnv reads CONSUMER_DB_JSON_STORAGE
+func jsonStorageFromEnv() (jsonStorage, error) {
+	mode := jsonStorage(util.GetenvDefault("CONSUMER_DB_JSON_STORAGE", string(jsonStorageUnknown)))
+
+	switch mode {
+	case jsonStorageOff, jsonStorageUnknown, jsonStorageAll:
+		return mode, nil
+	default:
+		return "", errors.New(fmt.Sprintf("bad JSON storage mode \"%s\"", mode))
+	}
+}
+
+// tables returns the tables a packet of the given type is written to
+func (mode jsonStorage) tables(packetType string, packet common.Packet) ([]*packetTable, error) {
+	table, ok := packetTables[packetType]
+
+	switch {
+	case ok && (mode == jsonStorageAll || mode == jsonStorageUnknown && len(packet.Extra) != 0):
+		return []*packetTable{table, &jsonPacketTable}, nil
+	case ok:
+		return []*packetTable{table}, nil
+	case mode != jsonStorageOff:
+		return []*packetTable{&jsonPacketTable}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("no table for packets of type %s", packetType))
+	}
+}
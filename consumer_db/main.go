@@ -1,33 +1,15 @@
 package main
 
 import (
-	"context"
-	"database/sql"
-	"encoding/json"
-	"github.com/go-sql-driver/mysql"
+	"errors"
+	"fmt"
 	"github.com/joho/godotenv"
-	"github.com/streadway/amqp"
 	"github.com/xor-shift/teleserver/common"
+	"github.com/xor-shift/teleserver/migrations"
+	"github.com/xor-shift/teleserver/storage"
+	"github.com/xor-shift/teleserver/util"
 	"log"
-	"os"
-)
-
-const (
-	bigInsertQuery = "" +
-		"INSERT INTO packets (session_id, packet_order, reported_time" +
-		", battery_voltages, battery_temperatures, spent_mah, spent_mwh, curr, percent_soc" +
-		", hydro_curr, hydro_ppm, hydro_temp" +
-		", temperature_smps, temperature_engine_driver, voltage_engine_driver, current_engine_driver, voltage_telemetry, current_telemetry, voltage_smps, current_smps, voltage_bms, current_bms" +
-		", speed, rpm, voltage_engine, current_engine" +
-		", latitude, longitude, gyro_x, gyro_y, gyro_z" +
-		", queue_fill_amt, tick_counter, free_heap, alloc_count, free_count, cpu_usage" +
-		") VALUES (?, ?, FROM_UNIXTIME(?), " +
-		"?, ?, ?, ?, ?, ?, " +
-		"?, ?, ?, " +
-		"?, ?, ?, ?, ?, ?, ?, ?, ?, ?, " +
-		"?, ?, ?, ?, " +
-		"?, ?, ?, ?, ?, " +
-		"?, ?, ?, ?, ?, ?)"
+	"time"
 )
 
 func init() {
@@ -40,73 +22,142 @@ func init() {
 func main() {
 	var err error
 
-	var consumer *common.AMQPConsumer
-	var db *sql.DB
+	var bus common.Bus
+	var subscription common.Subscription
+	var db *storage.DB
 
-	dbConfig := mysql.Config{
-		User:                 os.Getenv("DB_USER"),
-		Passwd:               os.Getenv("DB_PASSWORD"),
-		Addr:                 os.Getenv("DB_ADDRESS"),
-		DBName:               os.Getenv("DB_NAME"),
-		Collation:            "utf8mb4_general_ci",
-		Net:                  "tcp",
-		AllowNativePasswords: true,
+	if db, err = storage.Open(); err != nil {
+		log.Fatalln(err)
 	}
 
-	if db, err = sql.Open("mysql", dbConfig.FormatDSN()); err != nil {
+	if err = migrations.Check(db); err != nil {
 		log.Fatalln(err)
 	}
 
-	if consumer, err = common.NewAMQPConsumer(
-		"consumer_db_queue",
-		"consumer_db_consumer",
-		func(delivery amqp.Delivery) error {
-			var amqpPacket common.AMQPPacket
+	// instances of consumer_db share a durable queue by default so that packets are written exactly once and the
+	// backlog survives restarts
+	queueConfig, err := common.QueueConfigFromEnv("CONSUMER_DB", common.QueueConfig{
+		Exchange:     common.PacketExchange,
+		ExchangeType: common.PacketExchangeType,
+
+		Queue:   "consumer_db_queue",
+		Durable: true,
+
+		Prefetch: 64,
+	})
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	batchSize, err := util.GetenvUint("CONSUMER_DB_BATCH_SIZE", 64)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if batchSize == 0 || batchSize > maxBatchSize() {
+		log.Fatalf("CONSUMER_DB_BATCH_SIZE must be between 1 and %d", maxBatchSize())
+	}
+
+	batchWindow, err := util.GetenvDuration("CONSUMER_DB_BATCH_WINDOW", 200*time.Millisecond)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	policy, err := conflictPolicyFromEnv()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	jsonMode, err := jsonStorageFromEnv()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// the primary key of a hypertable includes reported_time, only keep_first catches the packets that reuse a
+	// sequence id with a different reported time, see migrations.CreateHypertable
+	if hypertable, err := migrations.IsHypertable(db, fullPacketTable.name); err != nil {
+		log.Fatalln(err)
+	} else if hypertable && policy != conflictKeepFirst {
+		log.Fatalf("the conflict policy \"%s\" isn't idempotent on the %s hypertable, use \"%s\"", policy, fullPacketTable.name, conflictKeepFirst)
+	}
+
+	// batches are only as large as the number of unacked deliveries the bus hands out, see CONSUMER_DB_PREFETCH
+	packetWriter := newWriter(db, policy, batchSize)
+	packetBatcher := newBatcher(batchSize, batchWindow, packetWriter.flush)
+
+	if bus, err = common.NewAMQPBus(); err != nil {
+		log.Fatalln(err)
+	}
 
-			if amqpPacket, err = common.ParseAMQPPacket(&delivery); err != nil {
-				log.Printf("error decoding a packet with gob: %s", err)
+	if subscription, err = bus.Subscribe(
+		queueConfig,
+		"consumer_db_consumer",
+		func(delivery *common.Delivery) {
+			amqpPacket, err := common.ParseMessage(delivery.Message)
+			if err != nil {
+				_ = delivery.Fail(common.Permanent(errors.New(fmt.Sprintf("error decoding a packet: %s", err))))
+				return
 			}
 
-			var tx *sql.Tx
-			tx, err = db.BeginTx(context.TODO(), nil)
+			packetType, err := common.PacketType(amqpPacket.Packet.Inner)
 			if err != nil {
-				//log.Printf("failed writing a message to the db (BeginTx): %s", err)
-				return err
+				_ = delivery.Fail(common.Permanent(err))
+				return
 			}
-			defer tx.Rollback()
 
-			var stmt *sql.Stmt
-			if stmt, err = tx.Prepare(bigInsertQuery); err != nil {
-				return err
+			tables, err := jsonMode.tables(packetType, amqpPacket.Packet)
+			if err != nil {
+				_ = delivery.Fail(common.Permanent(err))
+				return
 			}
-			defer stmt.Close()
-
-			packet := amqpPacket.Packet
-			inner := packet.Inner.(common.FullPacket)
-
-			batteryVoltages, _ := json.Marshal(inner.BatteryVoltages[:])
-			batteryTemperatures, _ := json.Marshal(inner.BatteryTemperatures[:])
-
-			if _, err = stmt.Exec(
-				amqpPacket.SessionID, packet.SequenceID, packet.Timestamp,
-				string(batteryVoltages), string(batteryTemperatures), inner.SpentMilliAmpHours, inner.SpentMilliWattHours, inner.Current, inner.PercentSOC,
-				inner.HydroCurrent, inner.HydroPPM, inner.HydroTemperature,
-				inner.TemperatureSMPS, inner.TemperatureEngineDriver, inner.VCEngineDriver[0], inner.VCEngineDriver[1], inner.VCTelemetry[0], inner.VCTelemetry[1], inner.VCSMPS[0], inner.VCSMPS[1], inner.VCBMS[0], inner.VCBMS[1],
-				inner.Speed, inner.RPM, inner.VCEngine[0], inner.VCEngine[1],
-				inner.Latitude, inner.Longitude, inner.Gyro[0], inner.Gyro[1], inner.Gyro[2],
-				inner.QueueFillAmount, inner.TickCounter, inner.FreeHeap, inner.AllocCount, inner.FreeCount, inner.CPUUsage,
-			); err != nil {
-				return err
+
+			pending, err := newPendingPacket(amqpPacket, tables, delivery)
+			if err != nil {
+				_ = delivery.Fail(common.Permanent(err))
+				return
 			}
 
-			return tx.Commit()
+			// requeued if the consumer is shutting down
+			if err = packetBatcher.add(pending); err != nil {
+				_ = delivery.Fail(err)
+			}
 		}); err != nil {
 		log.Fatalln(err)
 	}
 
-	if err = consumer.Start(); err != nil {
-		log.Fatalln(err)
+	shutdownSignal, stop := common.ShutdownSignalContext()
+	defer stop()
+
+	<-shutdownSignal.Done()
+	log.Println("shutting down")
+
+	ctx, cancel := common.ShutdownContext()
+	defer cancel()
+
+	// the packets that were already delivered are written and acked before the subscription and the database are
+	// closed
+	if err = subscription.Stop(ctx); err != nil {
+		log.Printf("failed to drain the subscription: %s", err)
 	}
 
-	consumer.Wait()
+	if err = packetBatcher.stop(ctx); err != nil {
+		log.Printf("failed to write the last batch: %s", err)
+	}
+
+	if err = subscription.Close(); err != nil {
+		log.Printf("failed to close the subscription: %s", err)
+	}
+
+	if err = bus.Close(); err != nil {
+		log.Printf("failed to close the bus: %s", err)
+	}
+
+	if err = packetWriter.Close(); err != nil {
+		log.Printf("failed to close the statements: %s", err)
+	}
+
+	if err = db.Close(); err != nil {
+		log.Printf("failed to close the database: %s", err)
+	}
 }
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/xor-shift/teleserver/common"
+	"github.com/xor-shift/teleserver/storage"
+	"log"
+	"strings"
+	"sync"
+)
+
+// maxPlaceholders is the number of placeholders MySQL and PostgreSQL accept in a prepared statement
+const maxPlaceholders = 65535
+
+// packetTable describes how the packets of one type are stored, several rows at a time
+type packetTable struct {
+	name string
+	// columns are the columns that are written in the order of the values returned by row, payload_hash excluded
+	columns []string
+
+	row func(amqpPacket common.AMQPPacket) []any
+}
+
+// columnPlaceholders return the placeholders of the columns whose values are converted by the database
+var columnPlaceholders = map[string]func(dialect storage.Dialect) string{
+	"reported_time": func(dialect storage.Dialect) string { return dialect.FromUnixTime("?") },
+}
+
+// packetKeyColumns are the primary key of every packet table
+var packetKeyColumns = []string{"session_id", "packet_order"}
+
+var fullPacketTable = packetTable{
+	name: "packets",
+	columns: []string{
+		"session_id", "packet_order", "reported_time",
+		"battery_voltages", "battery_temperatures", "spent_mah", "spent_mwh", "curr", "percent_soc",
+		"hydro_curr", "hydro_ppm", "hydro_temp",
+		"temperature_smps", "temperature_engine_driver", "voltage_engine_driver", "current_engine_driver", "voltage_telemetry", "current_telemetry", "voltage_smps", "current_smps", "voltage_bms", "current_bms",
+		"speed", "rpm", "voltage_engine", "current_engine",
+		"latitude", "longitude", "gyro_x", "gyro_y", "gyro_z",
+		"queue_fill_amt", "tick_counter", "free_heap", "alloc_count", "free_count", "cpu_usage",
+	},
+
+	row: func(amqpPacket common.AMQPPacket) []any {
+		packet := amqpPacket.Packet
+		inner := packet.Inner.(common.FullPacket)
+
+		batteryVoltages, _ := json.Marshal(inner.BatteryVoltages[:])
+		batteryTemperatures, _ := json.Marshal(inner.BatteryTemperatures[:])
+
+		return []any{
+			amqpPacket.SessionID, packet.SequenceID, packet.Timestamp,
+			string(batteryVoltages), string(batteryTemperatures), inner.SpentMilliAmpHours, inner.SpentMilliWattHours, inner.Current, inner.PercentSOC,
+			inner.HydroCurrent, inner.HydroPPM, inner.HydroTemperature,
+			inner.TemperatureSMPS, inner.TemperatureEngineDriver, inner.VCEngineDriver[0], inner.VCEngineDriver[1], inner.VCTelemetry[0], inner.VCTelemetry[1], inner.VCSMPS[0], inner.VCSMPS[1], inner.VCBMS[0], inner.VCBMS[1],
+			inner.Speed, inner.RPM, inner.VCEngine[0], inner.VCEngine[1],
+			inner.Latitude, inner.Longitude, inner.Gyro[0], inner.Gyro[1], inner.Gyro[2],
+			inner.QueueFillAmount, inner.TickCounter, inner.FreeHeap, inner.AllocCount, inner.FreeCount, inner.CPUUsage,
+		}
+	},
+}
+
+var essentialsPacketTable = packetTable{
+	name: "essential_packets",
+	columns: []string{
+		"session_id", "packet_order", "reported_time",
+		"speed", "battery_temperatures", "voltage", "remaining_wh",
+	},
+
+	row: func(amqpPacket common.AMQPPacket) []any {
+		packet := amqpPacket.Packet
+		inner := packet.Inner.(common.EssentialsPacket)
+
+		batteryTemperatures, _ := json.Marshal(inner.BatteryTemperatures[:])
+
+		return []any{
+			amqpPacket.SessionID, packet.SequenceID, packet.Timestamp,
+			inner.Speed, string(batteryTemperatures), inner.Voltage, inner.RemainingWattHours,
+		}
+	},
+}
+
+// packetTables maps the packet types to their tables
+var packetTables = map[string]*packetTable{
+	common.PacketTypeFull:       &fullPacketTable,
+	common.PacketTypeEssentials: &essentialsPacketTable,
+}
+
+// insertQuery builds a statement that inserts `rows` rows, keys that already exist are resolved as `policy` says
+func (table *packetTable) insertQuery(dialect storage.Dialect, rows int, policy conflictPolicy) string {
+	columns := append(append([]string{}, table.columns...), "payload_hash")
+
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		if placeholder, ok := columnPlaceholders[column]; ok {
+			placeholders[i] = placeholder(dialect)
+		} else {
+			placeholders[i] = "?"
+		}
+	}
+
+	row := "(" + strings.Join(placeholders, ", ") + ")"
+
+	values := make([]string, rows)
+	for i := range values {
+		values[i] = row
+	}
+
+	var updates []string
+
+	if policy == conflictOverwrite {
+		for _, column := range columns {
+			if column != "session_id" && column != "packet_order" {
+				updates = append(updates, column)
+			}
+		}
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s %s",
+		table.name, strings.Join(columns, ", "), strings.Join(values, ", "), dialect.Upsert(table.name, packetKeyColumns, updates))
+}
+
+// hashesQuery builds a statement that selects the payload hashes of `rows` keys
+func (table *packetTable) hashesQuery(rows int) string {
+	keys := make([]string, rows)
+	for i := range keys {
+		keys[i] = "(?, ?)"
+	}
+
+	return fmt.Sprintf("SELECT session_id, packet_order, payload_hash FROM %s WHERE (session_id, packet_order) IN (%s)",
+		table.name, strings.Join(keys, ", "))
+}
+
+// maxBatchSize is the largest number of rows that fit in one insert statement of every table
+func maxBatchSize() uint {
+	size := uint(maxPlaceholders)
+
+	tables := []*packetTable{&jsonPacketTable}
+	for _, table := range packetTables {
+		tables = append(tables, table)
+	}
+
+	for _, table := range tables {
+		if rows := uint(maxPlaceholders / (len(table.columns) + 1)); rows < size {
+			size = rows
+		}
+	}
+
+	return size
+}
+
+type packetKey struct {
+	sessionID  uint
+	sequenceID uint
+}
+
+// pendingPacket is a packet waiting in a batch, its delivery is acked once the packet is written to all of its tables
+type pendingPacket struct {
+	amqpPacket common.AMQPPacket
+	tables     []*packetTable
+	delivery   *common.Delivery
+
+	// payload is the JSON encoding of the packet and payloadHash its SHA-256, copies of a packet have the same hash
+	payload     []byte
+	payloadHash string
+}
+
+func newPendingPacket(amqpPacket common.AMQPPacket, tables []*packetTable, delivery *common.Delivery) (pendingPacket, error) {
+	payload, err := json.Marshal(amqpPacket.Packet)
+	if err != nil {
+		return pendingPacket{}, err
+	}
+
+	hash := sha256.Sum256(payload)
+
+	return pendingPacket{
+		amqpPacket: amqpPacket,
+		tables:     tables,
+		delivery:   delivery,
+
+		payload:     payload,
+		payloadHash: hex.EncodeToString(hash[:]),
+	}, nil
+}
+
+func (pending pendingPacket) key() packetKey {
+	return packetKey{
+		sessionID:  pending.amqpPacket.SessionID,
+		sequenceID: pending.amqpPacket.Packet.SequenceID,
+	}
+}
+
+// writer writes batches of packets with one multi-row insert per table in a single transaction
+type writer struct {
+	db        *storage.DB
+	policy    conflictPolicy
+	batchSize int
+
+	// statements caches the statements by their queries. database/sql prepares them once on every connection they're
+	// used on, so only the queries of single rows and of full batches are cached, see exec.
+	statementsMutex *sync.Mutex
+	statements      map[string]*sql.Stmt
+}
+
+func newWriter(db *storage.DB, policy conflictPolicy, batchSize uint) *writer {
+	return &writer{
+		db:        db,
+		policy:    policy,
+		batchSize: int(batchSize),
+
+		statementsMutex: &sync.Mutex{},
+		statements:      map[string]*sql.Stmt{},
+	}
+}
+
+func (w *writer) statement(query string) (*sql.Stmt, error) {
+	w.statementsMutex.Lock()
+	defer w.statementsMutex.Unlock()
+
+	if stmt, ok := w.statements[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := w.db.Prepare(w.db.Rebind(query))
+	if err != nil {
+		return nil, err
+	}
+
+	w.statements[query] = stmt
+
+	return stmt, nil
+}
+
+// prepared tells whether the query built for `rows` rows is prepared. Preparing the queries of every batch size would
+// take up to a statement per size, table and connection, and run into MySQL's max_prepared_stmt_count.
+func (w *writer) prepared(rows int) bool {
+	return rows == 1 || rows == w.batchSize
+}
+
+// exec runs a query built for `rows` rows in a transaction, prepared or as it is
+func (w *writer) exec(tx *sql.Tx, query string, rows int, args ...any) (sql.Result, error) {
+	if !w.prepared(rows) {
+		return tx.Exec(w.db.Rebind(query), args...)
+	}
+
+	stmt, err := w.statement(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.Stmt(stmt).Exec(args...)
+}
+
+// query is exec for queries that return rows
+func (w *writer) query(tx *sql.Tx, query string, rows int, args ...any) (*sql.Rows, error) {
+	if !w.prepared(rows) {
+		return tx.Query(w.db.Rebind(query), args...)
+	}
+
+	stmt, err := w.statement(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.Stmt(stmt).Query(args...)
+}
+
+// write inserts every packet of a batch in one transaction
+func (w *writer) write(batch []pendingPacket) error {
+	var tables []*packetTable
+	byTable := map[*packetTable][]pendingPacket{}
+
+	for _, pending := range batch {
+		for _, table := range pending.tables {
+			if _, ok := byTable[table]; !ok {
+				tables = append(tables, table)
+			}
+
+			byTable[table] = append(byTable[table], pending)
+		}
+	}
+
+	tx, err := w.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		packets := byTable[table]
+
+		if w.policy != conflictIgnore {
+			if packets, err = w.resolveConflicts(tx, table, packets); err != nil {
+				return err
+			}
+		}
+
+		if len(packets) == 0 {
+			continue
+		}
+
+		var args []any
+		for _, pending := range packets {
+			args = append(append(args, table.row(pending.amqpPacket)...), pending.payloadHash)
+		}
+
+		if _, err = w.exec(tx, table.insertQuery(w.db, len(packets), w.policy), len(packets), args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// flush writes a batch and acks its deliveries. If the batch can't be written as a whole, its packets are written one
+// by one so that a bad packet doesn't hold the others back.
+func (w *writer) flush(batch []pendingPacket) {
+	err := w.write(batch)
+	if err == nil {
+		for _, pending := range batch {
+			_ = pending.delivery.Ack()
+		}
+
+		return
+	}
+
+	if len(batch) == 1 {
+		_ = batch[0].delivery.Fail(err)
+		return
+	}
+
+	log.Printf("failed to write a batch of %d packets, writing them one by one: %s", len(batch), err)
+
+	for _, pending := range batch {
+		if err = w.write([]pendingPacket{pending}); err != nil {
+			_ = pending.delivery.Fail(err)
+			continue
+		}
+
+		_ = pending.delivery.Ack()
+	}
+}
+
+// Close closes the cached statements
+func (w *writer) Close() error {
+	w.statementsMutex.Lock()
+	defer w.statementsMutex.Unlock()
+
+	var firstErr error
+	for query, stmt := range w.statements {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		delete(w.statements, query)
+	}
+
+	return firstErr
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/xor-shift/teleserver/common"
+	"sync"
+)
+
+type latestKey struct {
+	deviceID   string
+	packetType string
+}
+
+// latestPackets keeps the latest packet of every type of every device. The subscription stores the packets while the
+// HTTP handlers read them.
+type latestPackets struct {
+	mutex   *sync.RWMutex
+	packets map[latestKey]common.AMQPPacket
+}
+
+func newLatestPackets() *latestPackets {
+	return &latestPackets{
+		mutex:   &sync.RWMutex{},
+		packets: map[latestKey]common.AMQPPacket{},
+	}
+}
+
+func (latest *latestPackets) store(packetType string, amqpPacket common.AMQPPacket) {
+	latest.mutex.Lock()
+	defer latest.mutex.Unlock()
+
+	latest.packets[latestKey{deviceID: amqpPacket.DeviceID, packetType: packetType}] = amqpPacket
+}
+
+// get returns the latest packet of a type from a device, or the zero packet if none came in yet
+func (latest *latestPackets) get(deviceID string, packetType string) common.AMQPPacket {
+	latest.mutex.RLock()
+	defer latest.mutex.RUnlock()
+
+	return latest.packets[latestKey{deviceID: deviceID, packetType: packetType}]
+}
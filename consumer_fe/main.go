@@ -2,10 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/kataras/iris/v12"
-	"github.com/streadway/amqp"
 	"github.com/xor-shift/teleserver/common"
 	"log"
 	"net/http"
@@ -22,43 +22,70 @@ func init() {
 func main() {
 	var err error
 
-	var consumer *common.AMQPConsumer
+	var bus common.Bus
+	var subscription common.Subscription
 	var app *iris.Application
 
-	var lastFullPacket common.AMQPPacket
+	latest := newLatestPackets()
 
-	if consumer, err = common.NewAMQPConsumer(
-		"consumer_fe_queue",
-		"consumer_fe_consumer",
-		func(delivery amqp.Delivery) error {
-			var amqpPacket common.AMQPPacket
+	// every instance of consumer_fe gets its own short queue as it only shows the latest packets
+	queueConfig, err := common.QueueConfigFromEnv("CONSUMER_FE", common.QueueConfig{
+		Exchange:     common.PacketExchange,
+		ExchangeType: common.PacketExchangeType,
 
-			if amqpPacket, err = common.ParseAMQPPacket(&delivery); err != nil {
-				log.Printf("error decoding a packet with gob: %s", err)
-			}
+		Queue:      "",
+		Exclusive:  true,
+		AutoDelete: true,
 
-			packet := amqpPacket.Packet
-			fullPacket, ok := packet.Inner.(common.FullPacket)
-			if !ok {
+		Prefetch:  64,
+		MaxLength: 1024,
+	})
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if bus, err = common.NewAMQPBus(); err != nil {
+		log.Fatalln(err)
+	}
+
+	if subscription, err = bus.Subscribe(
+		queueConfig,
+		"consumer_fe_consumer",
+		common.AckingHandler(func(delivery *common.Delivery) error {
+			amqpPacket, err := common.ParseMessage(delivery.Message)
+			if err != nil {
+				// consumer_db dead-letters these, there's nothing to show
+				log.Printf("error decoding a packet: %s", err)
 				return nil
 			}
 
-			log.Printf("%d @ %d: %d, %d (%d/%d)",
-				packet.SequenceID,
-				packet.Timestamp,
-				fullPacket.QueueFillAmount,
-				fullPacket.FreeHeap,
-				fullPacket.AllocCount,
-				fullPacket.FreeCount)
+			packet := amqpPacket.Packet
 
-			lastFullPacket = amqpPacket
+			switch inner := packet.Inner.(type) {
+			case common.FullPacket:
+				log.Printf("%d @ %d: %d, %d (%d/%d)",
+					packet.SequenceID,
+					packet.Timestamp,
+					inner.QueueFillAmount,
+					inner.FreeHeap,
+					inner.AllocCount,
+					inner.FreeCount)
+
+				latest.store(common.PacketTypeFull, amqpPacket)
+			case common.EssentialsPacket:
+				log.Printf("%d @ %d (essentials): %f km/h, %f V, %f Wh",
+					packet.SequenceID,
+					packet.Timestamp,
+					inner.Speed,
+					inner.Voltage,
+					inner.RemainingWattHours)
+
+				latest.store(common.PacketTypeEssentials, amqpPacket)
+			}
 
 			return nil
-		}); err != nil {
-		log.Fatalln(err)
-	}
-
-	if err = consumer.Start(); err != nil {
+		})); err != nil {
 		log.Fatalln(err)
 	}
 
@@ -68,9 +95,8 @@ func main() {
 		_, _ = ctx.Text("OK")
 	})
 
-	app.Get("/data", func(ctx iris.Context) {
-		var jsonData []byte
-		jsonData, err = json.Marshal(lastFullPacket)
+	serveJSON := func(ctx iris.Context, v any) {
+		jsonData, err := json.Marshal(v)
 
 		if err != nil {
 			ctx.StatusCode(http.StatusInternalServerError)
@@ -80,9 +106,70 @@ func main() {
 
 		ctx.ContentType("application/json")
 		_, _ = ctx.Text(string(jsonData))
+	}
+
+	app.Get("/health", func(ctx iris.Context) {
+		health := subscription.Health()
+		if health.State != common.BusConnected {
+			ctx.StatusCode(http.StatusServiceUnavailable)
+		}
+
+		serveJSON(ctx, struct {
+			Bus common.BusHealth `json:"bus"`
+		}{
+			Bus: health,
+		})
 	})
 
-	if err = app.Listen(fmt.Sprintf(":%s", os.Getenv("CONSUMER_FE_PORT"))); err != nil {
-		log.Fatalln(err)
+	// the bare routes show the packets of common.DefaultDeviceID, other devices use the same routes under
+	// /device/{device}
+	deviceID := func(ctx iris.Context) string {
+		if device := ctx.Params().Get("device"); device != "" {
+			return device
+		}
+
+		return common.DefaultDeviceID
+	}
+
+	getData := func(ctx iris.Context) {
+		serveJSON(ctx, latest.get(deviceID(ctx), common.PacketTypeFull))
+	}
+
+	getEssentialsData := func(ctx iris.Context) {
+		serveJSON(ctx, latest.get(deviceID(ctx), common.PacketTypeEssentials))
+	}
+
+	app.Get("/data", getData)
+	app.Get("/data/essentials", getEssentialsData)
+
+	deviceParty := app.Party("/device/{device:string}")
+	deviceParty.Get("/data", getData)
+	deviceParty.Get("/data/essentials", getEssentialsData)
+
+	shutdownSignal, stop := common.ShutdownSignalContext()
+	defer stop()
+
+	go func() {
+		if err := app.Listen(fmt.Sprintf(":%s", os.Getenv("CONSUMER_FE_PORT")), iris.WithoutInterruptHandler); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalln(err)
+		}
+	}()
+
+	<-shutdownSignal.Done()
+	log.Println("shutting down")
+
+	ctx, cancel := common.ShutdownContext()
+	defer cancel()
+
+	if err = app.Shutdown(ctx); err != nil {
+		log.Printf("failed to shut the http server down: %s", err)
+	}
+
+	if err = common.ShutdownSubscription(ctx, subscription); err != nil {
+		log.Printf("failed to drain the subscription: %s", err)
+	}
+
+	if err = bus.Close(); err != nil {
+		log.Printf("failed to close the bus: %s", err)
 	}
 }
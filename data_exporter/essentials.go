@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/xor-shift/teleserver/storage"
+	"log"
+	"time"
+)
+
+type essentialsRow struct {
+	PacketOrder  int
+	InsertTime   time.Time
+	ReportedTime time.Time
+
+	Speed               float32
+	BatteryTemperatures [5]float32
+	Voltage             float32
+	RemainingWattHours  float32
+}
+
+func fetchEssentialsRows(db *storage.DB, args Args) []essentialsRow {
+	var err error
+
+	const selectQuery string = "SELECT packet_order, insert_time, reported_time, speed, battery_temperatures, voltage, remaining_wh FROM essential_packets WHERE session_id=?"
+
+	var sqlRows *sql.Rows
+	if sqlRows, err = db.Query(db.Rebind(selectQuery), args.Session); err != nil {
+		log.Fatalf("Failed to fetch essentials rows for session %d: %s", args.Session, err)
+	}
+
+	var rows []essentialsRow
+	for i := 0; sqlRows.Next(); i++ {
+		var row essentialsRow
+
+		var temperaturesString string
+
+		if err = sqlRows.Scan(
+			&row.PacketOrder, &row.InsertTime, &row.ReportedTime,
+			&row.Speed,
+			&temperaturesString,
+			&row.Voltage,
+			&row.RemainingWattHours,
+		); err != nil {
+			log.Fatalf("error while reading essentials row %d of session %d: %s", i, args.Session, err)
+		}
+
+		if err = json.Unmarshal([]byte(temperaturesString), &row.BatteryTemperatures); err != nil {
+			log.Fatalf("error while parsing battery temperatures of essentials row %d of session %d: %s", i, args.Session, err)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+func essentialsColumns(args Args) []string {
+	columns := []string{
+		"Packet Order",
+		"Insert Time",
+		"Reported Time",
+		"Speed",
+	}
+
+	for i := 0; i < 5; i++ {
+		columns = append(columns, fmt.Sprintf("Temp %d", i))
+	}
+
+	columns = append(columns, []string{
+		"Voltage",
+		"Remaining Wh",
+	}...)
+
+	return columns
+}
+
+func essentialsRecords(rows []essentialsRow, args Args) [][]string {
+	records := [][]string{}
+
+	for _, row := range rows {
+		rowStrings := []string{}
+
+		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.PacketOrder))
+		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.InsertTime.Unix()))
+		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.ReportedTime.Unix()))
+		rowStrings = append(rowStrings, fmt.Sprintf("%f", row.Speed))
+
+		for _, v := range row.BatteryTemperatures {
+			rowStrings = append(rowStrings, fmt.Sprintf("%f", v))
+		}
+
+		rowStrings = append(rowStrings, fmt.Sprintf("%f", row.Voltage))
+		rowStrings = append(rowStrings, fmt.Sprintf("%f", row.RemainingWattHours))
+
+		records = append(records, rowStrings)
+	}
+
+	return records
+}
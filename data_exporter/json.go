@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/xor-shift/teleserver/storage"
+	"log"
+	"sort"
+	"time"
+)
+
+type jsonRow struct {
+	PacketOrder  int
+	InsertTime   time.Time
+	ReportedTime time.Time
+	PacketType   string
+
+	// Fields are the values of the packet flattened into "key.subkey" or "key.index" paths
+	Fields map[string]string
+}
+
+func fetchJSONRows(db *storage.DB, args Args) []jsonRow {
+	var err error
+
+	selectQuery := "SELECT packet_order, insert_time, reported_time, packet_type, inner_data FROM packets_json WHERE session_id=?"
+	queryArgs := []any{args.Session}
+
+	if args.PacketType != "" {
+		selectQuery += " AND packet_type=?"
+		queryArgs = append(queryArgs, args.PacketType)
+	}
+
+	var sqlRows *sql.Rows
+	if sqlRows, err = db.Query(db.Rebind(selectQuery+" ORDER BY packet_order"), queryArgs...); err != nil {
+		log.Fatalf("Failed to fetch JSON rows for session %d: %s", args.Session, err)
+	}
+
+	var rows []jsonRow
+	for i := 0; sqlRows.Next(); i++ {
+		row := jsonRow{Fields: map[string]string{}}
+
+		var innerData string
+
+		if err = sqlRows.Scan(&row.PacketOrder, &row.InsertTime, &row.ReportedTime, &row.PacketType, &innerData); err != nil {
+			log.Fatalf("error while reading JSON row %d of session %d: %s", i, args.Session, err)
+		}
+
+		// numbers are kept as they were written instead of going through float64
+		decoder := json.NewDecoder(bytes.NewReader([]byte(innerData)))
+		decoder.UseNumber()
+
+		var inner any
+		if err = decoder.Decode(&inner); err != nil {
+			log.Fatalf("error while parsing the data of JSON row %d of session %d: %s", i, args.Session, err)
+		}
+
+		flattenJSON("", inner, row.Fields)
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// flattenJSON adds the scalars in `value` to `fields`, keyed by their paths below `prefix`
+func flattenJSON(prefix string, value any, fields map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+
+		return prefix + "." + key
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		for key, v := range value {
+			flattenJSON(join(key), v, fields)
+		}
+	case []any:
+		for i, v := range value {
+			flattenJSON(join(fmt.Sprintf("%d", i)), v, fields)
+		}
+	case nil:
+		fields[prefix] = ""
+	default:
+		fields[prefix] = fmt.Sprintf("%v", value)
+	}
+}
+
+// jsonFields returns the paths of the fields of every row, sorted. Rows of different types or versions of a type can
+// have different fields, their missing fields are left empty.
+func jsonFields(rows []jsonRow) []string {
+	seen := map[string]bool{}
+	var fields []string
+
+	for _, row := range rows {
+		for field := range row.Fields {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	sort.Strings(fields)
+
+	return fields
+}
+
+func jsonColumns(rows []jsonRow, args Args) []string {
+	columns := []string{
+		"Packet Order",
+		"Insert Time",
+		"Reported Time",
+		"Packet Type",
+	}
+
+	return append(columns, jsonFields(rows)...)
+}
+
+func jsonRecords(rows []jsonRow, args Args) [][]string {
+	records := [][]string{}
+
+	fields := jsonFields(rows)
+
+	for _, row := range rows {
+		rowStrings := []string{}
+
+		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.PacketOrder))
+		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.InsertTime.Unix()))
+		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.ReportedTime.Unix()))
+		rowStrings = append(rowStrings, row.PacketType)
+
+		for _, field := range fields {
+			rowStrings = append(rowStrings, row.Fields[field])
+		}
+
+		records = append(records, rowStrings)
+	}
+
+	return records
+}
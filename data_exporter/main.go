@@ -2,19 +2,26 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/csv"
-	"encoding/json"
-	"fmt"
 	"github.com/alecthomas/kong"
-	"github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
+	"github.com/xor-shift/teleserver/migrations"
+	"github.com/xor-shift/teleserver/storage"
 	"log"
 	"os"
 	"text/template"
-	"time"
 )
 
+type Args struct {
+	Session            int    `name:"session" short:"s" help:"session number to export" required:""`
+	Out                string `name:"out" short:"o" default:"session_{{.SessionNo}}.csv" help:"File to output to (templated)"`
+	Type               string `name:"type" short:"t" enum:"full,essentials,json" default:"full" help:"Packet type to export, json exports the packets stored in packets_json"`
+	PacketType         string `name:"packet_type" short:"p" default:"" help:"(applicable only to json exports) type of the packets to export, every type if empty"`
+	Mode               string `name:"mode" short:"m" enum:"electro,hydro" default:"electro" help:"Data mode (applicable only to full packets)"`
+	Format             string `name:"format" short:"f" enum:"csv,json" default:"csv" help:"Data format"`
+	ExportColumnTitles bool   `name:"export_column_titles" negatable:"" default:"true" help:"(applicable only to CSV outputs) whether to include column titles for CSV exports"`
+}
+
 func init() {
 	err := godotenv.Load()
 	if err != nil {
@@ -25,112 +32,38 @@ func init() {
 func main() {
 	var err error
 
-	var db *sql.DB
+	var db *storage.DB
 
-	args := struct {
-		Session            int    `name:"session" short:"s" help:"session number to export" required:""`
-		Out                string `name:"out" short:"o" default:"session_{{.SessionNo}}.csv" help:"File to output to (templated)"`
-		Mode               string `name:"mode" short:"m" enum:"electro,hydro" default:"electro" help:"Data mode"`
-		Format             string `name:"format" short:"f" enum:"csv,json" default:"csv" help:"Data format"`
-		ExportColumnTitles bool   `name:"export_column_titles" negatable:"" default:"true" help:"(applicable only to CSV outputs) whether to include column titles for CSV exports"`
-	}{}
+	args := Args{}
 
 	_ = kong.Parse(&args)
 
-	dbConfig := mysql.Config{
-		User:                 os.Getenv("DB_USER"),
-		Passwd:               os.Getenv("DB_PASSWORD"),
-		Addr:                 os.Getenv("DB_ADDRESS"),
-		DBName:               os.Getenv("DB_NAME"),
-		Collation:            "utf8mb4_general_ci",
-		Net:                  "tcp",
-		AllowNativePasswords: true,
-		ParseTime:            true,
+	if db, err = storage.Open(); err != nil {
+		log.Fatalln(err)
 	}
 
-	if db, err = sql.Open("mysql", dbConfig.FormatDSN()); err != nil {
+	if err = migrations.Check(db); err != nil {
 		log.Fatalln(err)
 	}
 
 	defer db.Close()
 
-	type Row struct {
-		PacketOrder   int
-		TickCounterLF int
-		InsertTime    time.Time
-		ReportedTime  time.Time
-
-		BatteryVoltages     []float32
-		BatteryTemperatures [5]float32
-		SpentMAH            float32
-		SpentMWH            float32
-		Current             float32
-		SoC                 float32
-		Speed               float32
-		RPM                 float32
-		Latitude            float32
-		Longitude           float32
-		Gyro                [3]float32
-
-		HydroCurrent     float32
-		HydroPPM         float32
-		HydroTemperature float32
-
-		QueueFillAmount int
-		HeapFreeAmount  int
-		HeapAllocCount  int
-		HeapFreeCount   int
-		CPUUsage        float32
-	}
-
-	const selectQuery string = "SELECT packet_order, tick_counter, insert_time, reported_time, battery_voltages, battery_temperatures, spent_mah, spent_mwh, curr, percent_soc, speed, rpm, latitude, longitude, gyro_x, gyro_y, gyro_z, hydro_curr, hydro_ppm, hydro_temp, queue_fill_amt, free_heap, alloc_count, free_count, cpu_usage FROM packets WHERE session_id=?"
-
-	var sqlRows *sql.Rows
-	if sqlRows, err = db.Query(selectQuery, args.Session); err != nil {
-		log.Fatalf("Failed to fetch rows for session %d: %s", args.Session, err)
-	}
-
-	var rows []Row
-	for i := 0; sqlRows.Next(); i++ {
-		var row Row
-
-		var voltagesString string
-		var temperaturesString string
-
-		if err = sqlRows.Scan(
-			&row.PacketOrder, &row.TickCounterLF, &row.InsertTime, &row.ReportedTime,
-			&voltagesString, &temperaturesString,
-			&row.SpentMAH, &row.SpentMWH, &row.Current, &row.SoC,
-			&row.Speed, &row.RPM,
-			&row.Latitude, &row.Longitude,
-			&row.Gyro[0],
-			&row.Gyro[1],
-			&row.Gyro[2],
-			&row.HydroCurrent,
-			&row.HydroPPM,
-			&row.HydroTemperature,
-			&row.QueueFillAmount,
-			&row.HeapFreeAmount,
-			&row.HeapAllocCount,
-			&row.HeapFreeCount,
-			&row.CPUUsage,
-		); err != nil {
-			log.Fatalf("error while reading row %d of session %d: %s", i, args.Session, err)
-		}
-
-		if err = json.Unmarshal([]byte(voltagesString), &row.BatteryVoltages); err != nil {
-			log.Fatalf("error while parsing battery voltages of row %d of session %d: %s", i, args.Session, err)
-		}
-
-		if err = json.Unmarshal([]byte(temperaturesString), &row.BatteryTemperatures); err != nil {
-			log.Fatalf("error while parsing battery voltages of row %d of session %d: %s", i, args.Session, err)
-		}
-
-		if args.Mode == "hydro" {
-			row.BatteryVoltages = row.BatteryVoltages[0:20]
-		}
-
-		rows = append(rows, row)
+	var columns []string
+	var records [][]string
+
+	switch args.Type {
+	case "full":
+		rows := fetchFullRows(db, args)
+		columns = fullColumns(args)
+		records = fullRecords(rows, args)
+	case "essentials":
+		rows := fetchEssentialsRows(db, args)
+		columns = essentialsColumns(args)
+		records = essentialsRecords(rows, args)
+	case "json":
+		rows := fetchJSONRows(db, args)
+		columns = jsonColumns(rows, args)
+		records = jsonRecords(rows, args)
 	}
 
 	db.Close()
@@ -162,91 +95,11 @@ func main() {
 	csvWriter := csv.NewWriter(outFile)
 
 	if args.ExportColumnTitles {
-		columns := []string{
-			"Packet Order",
-			"Seconds Since Boot",
-			"Insert Time",
-			"Reported Time",
-		}
-
-		var cellCount int
-
-		if args.Mode == "hydro" {
-			cellCount = 20
-		} else {
-			cellCount = 27
-		}
-
-		for i := 0; i < cellCount; i++ {
-			columns = append(columns, fmt.Sprintf("Cell %d", i))
-		}
-
-		for i := 0; i < 5; i++ {
-			columns = append(columns, fmt.Sprintf("Temp %d", i))
-		}
-
-		columns = append(columns, []string{
-			"Spent mAh",
-			"Spent mWh",
-			"Current",
-			"SoC",
-			"Speed",
-			"RPM",
-		}...)
-
-		if args.Mode == "hydro" {
-			columns = append(columns, []string{
-				"Hydrogen Current",
-				"Hydrogen PPM",
-				"Hydrogen Temperature",
-			}...)
-		}
-
-		columns = append(columns, []string{
-			"Queue Fill Amt",
-			"Free Heap Bytes",
-			"malloc Calls",
-			"free Calls",
-		}...)
-
 		_ = csvWriter.Write(columns)
 	}
 
-	for _, row := range rows {
-		rowStrings := []string{}
-
-		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.PacketOrder))
-		rowStrings = append(rowStrings, fmt.Sprintf("%f", float32(row.TickCounterLF)/1000.))
-		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.InsertTime.Unix()))
-		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.ReportedTime.Unix()))
-
-		for _, v := range row.BatteryVoltages {
-			rowStrings = append(rowStrings, fmt.Sprintf("%f", v))
-		}
-
-		for _, v := range row.BatteryTemperatures {
-			rowStrings = append(rowStrings, fmt.Sprintf("%f", v))
-		}
-
-		rowStrings = append(rowStrings, fmt.Sprintf("%f", row.SpentMAH))
-		rowStrings = append(rowStrings, fmt.Sprintf("%f", row.SpentMWH))
-		rowStrings = append(rowStrings, fmt.Sprintf("%f", row.Current))
-		rowStrings = append(rowStrings, fmt.Sprintf("%f", row.SoC))
-		rowStrings = append(rowStrings, fmt.Sprintf("%f", row.Speed))
-		rowStrings = append(rowStrings, fmt.Sprintf("%f", row.RPM))
-
-		if args.Mode == "hydro" {
-			rowStrings = append(rowStrings, fmt.Sprintf("%f", row.HydroCurrent))
-			rowStrings = append(rowStrings, fmt.Sprintf("%f", row.HydroPPM))
-			rowStrings = append(rowStrings, fmt.Sprintf("%f", row.HydroTemperature))
-		}
-
-		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.QueueFillAmount))
-		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.HeapFreeAmount))
-		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.HeapAllocCount))
-		rowStrings = append(rowStrings, fmt.Sprintf("%d", row.HeapFreeCount))
-
-		csvWriter.Write(rowStrings)
+	for _, record := range records {
+		csvWriter.Write(record)
 	}
 
 	csvWriter.Flush()
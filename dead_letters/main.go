@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"github.com/alecthomas/kong"
+	"github.com/joho/godotenv"
+	"github.com/streadway/amqp"
+	"github.com/xor-shift/teleserver/common"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+type Args struct {
+	List struct {
+		Limit int `name:"limit" short:"n" default:"50" help:"Maximum number of dead letters to show"`
+	} `cmd:"" help:"Show the dead-lettered packets without removing them"`
+
+	Requeue struct {
+		Limit int    `name:"limit" short:"n" default:"0" help:"Maximum number of dead letters to requeue, 0 for all"`
+		Queue string `name:"queue" short:"q" help:"Queue to requeue to instead of the one the packets were dead-lettered from"`
+	} `cmd:"" help:"Put dead-lettered packets back into their queues"`
+}
+
+func init() {
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatalf("loading dotenv failed: %s", err)
+	}
+}
+
+func headerString(delivery *amqp.Delivery, key string) string {
+	if v, ok := delivery.Headers[key].(string); ok {
+		return v
+	}
+
+	return ""
+}
+
+func list(amqpChan *amqp.Channel, limit int) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "#\tQueue\tDead-lettered at\tRetries\tDevice\tSession\tSeq\tType\tError")
+
+	var last *amqp.Delivery
+
+	for i := 0; i < limit; i++ {
+		delivery, ok, err := amqpChan.Get(common.DeadLetterQueue, false)
+		if err != nil {
+			log.Fatalf("failed to get a dead letter: %s", err)
+		}
+
+		if !ok {
+			break
+		}
+
+		last = &delivery
+
+		deadLetteredAt := ""
+		if unix, ok := delivery.Headers[common.HeaderDeadLetteredAt].(int64); ok {
+			deadLetteredAt = time.Unix(unix, 0).Format(time.RFC3339)
+		}
+
+		packetDescription := "?\t?\t?\t?"
+		if amqpPacket, err := common.ParseAMQPPacket(&delivery); err == nil {
+			packetDescription = fmt.Sprintf("%s\t%d\t%d\t%T",
+				amqpPacket.DeviceID,
+				amqpPacket.SessionID,
+				amqpPacket.Packet.SequenceID,
+				amqpPacket.Packet.Inner)
+		}
+
+		_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\t%d\t%s\t%s\n",
+			i,
+			headerString(&delivery, common.HeaderOriginalQueue),
+			deadLetteredAt,
+			common.DeliveryRetries(&delivery),
+			packetDescription,
+			headerString(&delivery, common.HeaderError))
+	}
+
+	_ = writer.Flush()
+
+	// everything that was looked at goes back into the queue
+	if last != nil {
+		if err := last.Nack(true, true); err != nil {
+			log.Fatalf("failed to put the dead letters back: %s", err)
+		}
+	}
+}
+
+func requeue(amqpChan *amqp.Channel, limit int, queueOverride string) {
+	if err := amqpChan.Confirm(false); err != nil {
+		log.Fatalf("failed to enable publisher confirms: %s", err)
+	}
+
+	confirms := amqpChan.NotifyPublish(make(chan amqp.Confirmation, 1))
+	returns := amqpChan.NotifyReturn(make(chan amqp.Return, 1))
+
+	requeued := 0
+	var failed []amqp.Delivery
+
+	for limit == 0 || requeued+len(failed) < limit {
+		delivery, ok, err := amqpChan.Get(common.DeadLetterQueue, false)
+		if err != nil {
+			log.Fatalf("failed to get a dead letter: %s", err)
+		}
+
+		if !ok {
+			break
+		}
+
+		queue := queueOverride
+		if queue == "" {
+			queue = headerString(&delivery, common.HeaderOriginalQueue)
+		}
+
+		publishing := common.RepublishDelivery(&delivery, amqp.Table{})
+		for _, header := range []string{common.HeaderRetries, common.HeaderOriginalQueue, common.HeaderError, common.HeaderDeadLetteredAt} {
+			delete(publishing.Headers, header)
+		}
+
+		// mandatory so that packets whose queue is gone stay dead-lettered instead of vanishing
+		if err = amqpChan.Publish("", queue, true, false, publishing); err != nil {
+			log.Fatalf("failed to requeue a dead letter: %s", err)
+		}
+
+		// unroutable messages are returned before they're confirmed
+		confirmation := <-confirms
+
+		select {
+		case ret := <-returns:
+			log.Printf("could not requeue a dead letter to \"%s\": %s", queue, ret.ReplyText)
+			confirmation.Ack = false
+		default:
+		}
+
+		if !confirmation.Ack {
+			// put back once we're done, it would come back on the next Get otherwise
+			failed = append(failed, delivery)
+			continue
+		}
+
+		requeued++
+		_ = delivery.Ack(false)
+	}
+
+	for _, delivery := range failed {
+		_ = delivery.Nack(false, true)
+	}
+
+	log.Printf("requeued %d dead letters, %d failed", requeued, len(failed))
+}
+
+func main() {
+	args := Args{}
+
+	ctx := kong.Parse(&args)
+
+	conn, err := amqp.Dial(os.Getenv("AMQP_URL"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	defer conn.Close()
+
+	amqpChan, err := conn.Channel()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	defer amqpChan.Close()
+
+	if err = common.DeclareDeadLetters(amqpChan); err != nil {
+		log.Fatalln(err)
+	}
+
+	switch ctx.Command() {
+	case "list":
+		list(amqpChan, args.List.Limit)
+	case "requeue":
+		requeue(amqpChan, args.Requeue.Limit, args.Requeue.Queue)
+	}
+}
@@ -4,9 +4,11 @@ go 1.19
 
 require (
 	github.com/alecthomas/kong v0.7.1
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/go-sql-driver/mysql v1.7.0
 	github.com/joho/godotenv v1.4.0
 	github.com/kataras/iris/v12 v12.1.8
+	github.com/lib/pq v1.10.9
 	github.com/mitchellh/mapstructure v1.1.2
 	github.com/streadway/amqp v1.0.0
 )
@@ -46,6 +48,7 @@ require (
 	github.com/smartystreets/goconvey v1.7.2 // indirect
 	github.com/stretchr/testify v1.8.0 // indirect
 	github.com/valyala/fasthttp v1.43.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	github.com/xeipuuv/gojsonschema v1.2.0 // indirect
 	github.com/yalp/jsonpath v0.0.0-20180802001716-5cc68e5049a0 // indirect
 	github.com/yudai/gojsondiff v1.0.0 // indirect
@@ -0,0 +1,46 @@
+package ingest
+
+// RejectionReason tells why a packet or a whole batch of packets was not accepted
+type RejectionReason string
+
+const (
+	// RejectedParse is used for bodies that could not be parsed
+	RejectedParse RejectionReason = "parse"
+	// RejectedSignature is used for bodies with an invalid signature
+	RejectedSignature RejectionReason = "signature"
+	// RejectedNoSession is used for batches from devices without an active session
+	RejectedNoSession RejectionReason = "no_session"
+	// RejectedBusy is used for batches that were given up on because the server is overloaded, see OverloadPolicy
+	RejectedBusy RejectionReason = "busy"
+	// RejectedBadRNG is used for packets whose pRNG value doesn't match their sequence id
+	RejectedBadRNG RejectionReason = "bad_rng"
+	// RejectedDuplicate is used for packets that were already accepted, or that are too old to tell
+	RejectedDuplicate RejectionReason = "duplicate"
+	// RejectedInternal is used for packets that could not be forwarded because of a server-side error, these should be
+	// retransmitted
+	RejectedInternal RejectionReason = "internal"
+)
+
+type PacketRejection struct {
+	SequenceID uint            `json:"seq"`
+	Reason     RejectionReason `json:"reason"`
+}
+
+// Ack is the result of a batch of packets, meant to be sent back to the device so that it knows what to retransmit.
+type Ack struct {
+	Accepted   uint              `json:"accepted"`
+	Rejected   uint              `json:"rejected"`
+	Rejections []PacketRejection `json:"rejections"`
+
+	// HighestContiguousSequenceID is the sequence id up to which (inclusive) every packet was either accepted or
+	// can't be accepted anymore, -1 if there's no such sequence id
+	HighestContiguousSequenceID int64 `json:"highestContiguousSeq"`
+}
+
+func (ack *Ack) reject(sequenceID uint, reason RejectionReason) {
+	ack.Rejected++
+	ack.Rejections = append(ack.Rejections, PacketRejection{
+		SequenceID: sequenceID,
+		Reason:     reason,
+	})
+}
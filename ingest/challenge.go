@@ -0,0 +1,115 @@
+package ingest
+
+import (
+	"crypto/rand"
+	"errors"
+	"github.com/xor-shift/teleserver/util"
+	"time"
+)
+
+type resetChallenge struct {
+	token   [32]uint8
+	expires time.Time
+}
+
+// resetChallenges are the session reset challenges that were issued to devices and not answered yet. Anyone can ask
+// for a challenge, so they expire after a while and there can only be so many of them at once. The oldest challenge
+// makes room for a new one rather than devices being refused challenges.
+type resetChallenges struct {
+	ttl        time.Duration
+	max        uint
+	challenges map[string]resetChallenge
+}
+
+// resetChallengesFromEnv reads INGEST_RESET_CHALLENGE_TTL and INGEST_MAX_RESET_CHALLENGES
+func resetChallengesFromEnv() (resetChallenges, error) {
+	var err error
+
+	challenges := resetChallenges{
+		challenges: map[string]resetChallenge{},
+	}
+
+	if challenges.ttl, err = util.GetenvDuration("INGEST_RESET_CHALLENGE_TTL", time.Minute); err != nil {
+		return resetChallenges{}, err
+	}
+
+	if challenges.max, err = util.GetenvUint("INGEST_MAX_RESET_CHALLENGES", 1024); err != nil {
+		return resetChallenges{}, err
+	}
+
+	if challenges.max == 0 {
+		return resetChallenges{}, errors.New("there must be room for at least one session reset challenge")
+	}
+
+	return challenges, nil
+}
+
+func newResetToken() ([32]uint8, error) {
+	var resetToken [32]uint8
+	_, err := rand.Read(resetToken[:])
+
+	return resetToken, err
+}
+
+// get returns the challenge of a device if it has one that didn't expire
+func (challenges *resetChallenges) get(deviceID string, now time.Time) ([32]uint8, bool) {
+	challenge, ok := challenges.challenges[deviceID]
+	if !ok || !now.Before(challenge.expires) {
+		return [32]uint8{}, false
+	}
+
+	return challenge.token, true
+}
+
+// issue returns the challenge of a device, issuing a new one if it has none or if it expired. Once there is no room
+// left, the expired challenges are dropped, or the one that expires first if none did.
+func (challenges *resetChallenges) issue(deviceID string, now time.Time) ([32]uint8, error) {
+	if token, ok := challenges.get(deviceID, now); ok {
+		return token, nil
+	}
+
+	delete(challenges.challenges, deviceID)
+
+	if uint(len(challenges.challenges)) >= challenges.max {
+		challenges.evict(now)
+	}
+
+	token, err := newResetToken()
+	if err != nil {
+		return [32]uint8{}, err
+	}
+
+	challenges.challenges[deviceID] = resetChallenge{
+		token:   token,
+		expires: now.Add(challenges.ttl),
+	}
+
+	return token, nil
+}
+
+// evict drops the expired challenges, or the oldest one if none expired
+func (challenges *resetChallenges) evict(now time.Time) {
+	var oldestID string
+	var oldest time.Time
+
+	for id, challenge := range challenges.challenges {
+		if !now.Before(challenge.expires) {
+			delete(challenges.challenges, id)
+			continue
+		}
+
+		if oldestID == "" || challenge.expires.Before(oldest) {
+			oldestID = id
+			oldest = challenge.expires
+		}
+	}
+
+	if uint(len(challenges.challenges)) >= challenges.max {
+		delete(challenges.challenges, oldestID)
+	}
+}
+
+// remove drops the challenge of a device once it was answered
+func (challenges *resetChallenges) remove(deviceID string) {
+	delete(challenges.challenges, deviceID)
+}
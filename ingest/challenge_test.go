@@ -0,0 +1,63 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResetChallenges(t *testing.T) {
+	challenges := resetChallenges{
+		ttl:        time.Minute,
+		max:        2,
+		challenges: map[string]resetChallenge{},
+	}
+
+	now := time.Now()
+
+	first, err := challenges.issue("a", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again, _ := challenges.issue("a", now.Add(time.Second)); again != first {
+		t.Fatalf("a challenge that didn't expire was replaced")
+	}
+
+	if _, err = challenges.issue("b", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest challenge makes room for a new one
+	if _, err = challenges.issue("c", now.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := challenges.get("a", now.Add(2*time.Second)); ok {
+		t.Fatalf("the oldest challenge wasn't dropped")
+	}
+
+	if _, ok := challenges.get("b", now.Add(2*time.Second)); !ok {
+		t.Fatalf("a challenge other than the oldest was dropped")
+	}
+
+	later := now.Add(time.Minute + time.Second)
+
+	if _, ok := challenges.get("b", later); ok {
+		t.Fatalf("got an expired challenge")
+	}
+
+	// the expired challenges are all dropped once there is no room left
+	if _, err = challenges.issue("d", later); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(challenges.challenges) != 2 {
+		t.Fatalf("expected the expired challenge to be dropped, %d left", len(challenges.challenges))
+	}
+
+	challenges.remove("d")
+
+	if _, ok := challenges.get("d", later); ok {
+		t.Fatalf("got a removed challenge")
+	}
+}
@@ -1,159 +1,204 @@
 package ingest
 
 import (
-	"bytes"
+	"context"
 	"crypto/ecdsa"
-	"database/sql"
-	"encoding/gob"
 	"errors"
 	"fmt"
-	"github.com/go-sql-driver/mysql"
-	amqp "github.com/streadway/amqp"
 	"github.com/xor-shift/teleserver/common"
+	"github.com/xor-shift/teleserver/migrations"
+	"github.com/xor-shift/teleserver/storage"
 	"github.com/xor-shift/teleserver/util"
 	"log"
 	"math"
 	"math/big"
-	"math/rand"
-	"os"
+	"regexp"
 	"sync"
+	"time"
 )
 
-func advanceRNG(s [4]uint32) uint32 {
-	result := util.RotL(s[0]+s[3], 7) + s[0]
+// DefaultDeviceID is the device that requests without an explicit device identifier are attributed to.
+const DefaultDeviceID = common.DefaultDeviceID
 
-	t := s[1] << 9
+var deviceIDPattern = regexp.MustCompile("^[A-Za-z0-9_-]{1,64}$")
 
-	s[2] ^= s[0]
-	s[3] ^= s[1]
-	s[1] ^= s[2]
-	s[0] ^= s[3]
-
-	s[2] ^= t
-
-	s[3] = util.RotL(s[3], 11)
-
-	return result
-}
-
-type state struct {
-	sessionID        uint
-	initialRNGVector [4]uint32
+func ValidateDeviceID(deviceID string) error {
+	if !deviceIDPattern.MatchString(deviceID) {
+		return errors.New(fmt.Sprintf("bad device id \"%s\"", deviceID))
+	}
 
-	droppedPacketCt uint
+	return nil
 }
 
-// honestly this is a bad idea but xoroshiro is fairly fast
-func (state *state) getNthRNG(n uint) uint32 {
-	n += 1
-
-	var result uint32
-
-	s := state.initialRNGVector
-
-	for i := uint(0); i < n; i++ {
-		result = util.RotL(s[0]+s[3], 7) + s[0]
-
-		t := s[1] << 9
-
-		s[2] ^= s[0]
-		s[3] ^= s[1]
-		s[1] ^= s[2]
-		s[0] ^= s[3]
+// errDuplicatePacket is returned by newPacket for packets whose sequence id was already accepted in the session
+var errDuplicatePacket = errors.New("duplicate packet")
 
-		s[2] ^= t
+type packetBatch struct {
+	deviceID string
+	packets  []common.Packet
 
-		s[3] = util.RotL(s[3], 11)
-	}
+	result chan batchResult
+}
 
-	return result
+// batchResult is what became of a batch once it was processed
+type batchResult struct {
+	ack    Ack
+	reason RejectionReason
+	err    error
 }
 
 type Ingest struct {
-	db       *sql.DB
-	amqpConn *amqp.Connection
-	pubKey   ecdsa.PublicKey
-
-	resetToken [32]uint8
-
-	state state
+	db           *storage.DB
+	bus          common.Bus
+	packetFormat common.PacketFormat
+	pubKey       ecdsa.PublicKey
+
+	// sessionsMutex guards resetChallenges and sessions, both of which are keyed by device id, and retiredSessions
+	sessionsMutex   *sync.Mutex
+	resetChallenges resetChallenges
+	sessions        map[string]*state
+	// retiredSessions were replaced while some of their batches were still being processed, their statistics keep
+	// being persisted until the batches are done
+	retiredSessions []*state
+
+	// stopMutex guards stopped, batches are queued with a read lock held so that Stop can't close incomingPackets
+	// under their feet
+	stopMutex *sync.RWMutex
+	stopped   bool
 
 	packetProcessorWG *sync.WaitGroup
-	incomingPackets   chan []common.Packet
+	statsWG           *sync.WaitGroup
+	stopStats         chan struct{}
+	statsInterval     time.Duration
+	incomingPackets   chan packetBatch
+	queueConfig       queueConfig
+	queueCounters     queueCounters
 }
 
-func NewIngester(pubKey ecdsa.PublicKey) (*Ingest, error) {
+// NewIngester creates an ingester that publishes the packets it accepts to `bus`, which is left open by Close.
+func NewIngester(pubKey ecdsa.PublicKey, bus common.Bus) (*Ingest, error) {
 	var err error
 
+	queueConfig, err := queueConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	statsInterval, err := util.GetenvDuration("INGEST_STATS_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	resetChallenges, err := resetChallengesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	ingester := &Ingest{
-		db:       nil,
-		amqpConn: nil,
-		pubKey:   pubKey,
+		db:     nil,
+		bus:    bus,
+		pubKey: pubKey,
 
-		resetToken: [32]uint8{},
+		sessionsMutex:   &sync.Mutex{},
+		resetChallenges: resetChallenges,
+		sessions:        map[string]*state{},
 
-		state: state{},
+		stopMutex: &sync.RWMutex{},
 
 		packetProcessorWG: &sync.WaitGroup{},
-		incomingPackets:   make(chan []common.Packet, 128),
+		statsWG:           &sync.WaitGroup{},
+		stopStats:         make(chan struct{}),
+		statsInterval:     statsInterval,
+		incomingPackets:   make(chan packetBatch, queueConfig.size),
+		queueConfig:       queueConfig,
 	}
 
-	ingester.resetResetToken()
+	formatName := util.GetenvDefault("AMQP_PACKET_FORMAT", "json")
+	var ok bool
+	if ingester.packetFormat, ok = common.PacketFormatByName[formatName]; !ok {
+		return nil, errors.New(fmt.Sprintf("bad packet format \"%s\"", formatName))
+	}
 
-	if ingester.amqpConn, err = amqp.Dial(os.Getenv("AMQP_URL")); err != nil {
+	if ingester.db, err = storage.Open(); err != nil {
 		return nil, err
 	}
 
-	dbConfig := mysql.Config{
-		User:                 os.Getenv("DB_USER"),
-		Passwd:               os.Getenv("DB_PASSWORD"),
-		Addr:                 os.Getenv("DB_ADDRESS"),
-		DBName:               os.Getenv("DB_NAME"),
-		Collation:            "utf8mb4_general_ci",
-		Net:                  "tcp",
-		AllowNativePasswords: true,
+	if err = migrations.Check(ingester.db); err != nil {
+		return nil, err
 	}
 
-	if ingester.db, err = sql.Open("mysql", dbConfig.FormatDSN()); err != nil {
+	if err = ingester.resumeSessions(); err != nil {
 		return nil, err
 	}
 
 	return ingester, nil
 }
 
-func (ingest *Ingest) resetResetToken() {
-	generateBytes := func(sz uint) []uint8 {
-		if mod := sz % 8; mod != 0 {
-			sz += 8 - mod
-		}
+// resumeSessions loads the open sessions of every device from the database so that a restarted producer keeps
+// accepting packets from devices that are in the middle of a session.
+func (ingest *Ingest) resumeSessions() error {
+	rows, err := ingest.db.Query("select session_id, device_id, prng, prng_algorithm, " + sessionStatsColumns + " from sessions where closed = 0 order by session_id")
+	if err != nil {
+		return err
+	}
 
-		ret := make([]uint8, sz)
+	defer rows.Close()
 
-		for i := uint(0); i < sz/8; i++ {
-			v := rand.Uint64()
+	ingest.sessionsMutex.Lock()
+	defer ingest.sessionsMutex.Unlock()
 
-			for j := uint(0); j < 8; j++ {
-				ret[i*8+j] = uint8(v & 0xFF)
-				v >>= 8
-			}
+	for rows.Next() {
+		var sessionID uint
+		var deviceID string
+		var rngVectorString string
+		var rngAlgorithm string
+		var stats SessionStats
+
+		if err = rows.Scan(
+			&sessionID, &deviceID, &rngVectorString, &rngAlgorithm,
+			&stats.ReceivedPackets, &stats.HighestSequenceID, &stats.DroppedPackets, &stats.DuplicatePackets, &stats.OutOfOrderPackets,
+		); err != nil {
+			return err
+		}
+
+		rngVector := make([]uint32, len(rngVectorString)/8)
+		if err = util.StringToArray(rngVectorString, rngVector); err != nil {
+			log.Printf("not resuming session %d of device %s, bad pRNG vector: %s", sessionID, deviceID, err)
+			continue
+		}
+
+		session, err := newState(deviceID, sessionID, rngAlgorithm, rngVector)
+		if err != nil {
+			log.Printf("not resuming session %d of device %s: %s", sessionID, deviceID, err)
+			continue
 		}
 
-		return ret
+		session.resumeStats(stats)
+
+		// rows are ordered by their ids so the latest session of a device wins
+		ingest.sessions[session.deviceID] = session
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for deviceID, session := range ingest.sessions {
+		log.Printf("resumed session %d of device %s (%s)", session.sessionID, deviceID, session.rngAlgorithm)
 	}
 
-	generated := generateBytes(32)
-	copy(ingest.resetToken[:], generated[:32])
+	return nil
 }
 
-func (ingest *Ingest) validateResetSignature(r, s *big.Int) error {
-	if !ecdsa.Verify(&ingest.pubKey, ingest.resetToken[:], r, s) {
+func (ingest *Ingest) validateResetSignature(resetToken [32]uint8, r, s *big.Int) error {
+	if !ecdsa.Verify(&ingest.pubKey, resetToken[:], r, s) {
 		return errors.New("invalid signature")
 	}
 
 	return nil
 }
 
-func (ingest *Ingest) validateStringResetSignature(r, s string) error {
+func (ingest *Ingest) validateStringResetSignature(resetToken [32]uint8, r, s string) error {
 	rInt, rOk := big.NewInt(0).SetString(r, 16)
 	sInt, sOk := big.NewInt(0).SetString(s, 16)
 
@@ -165,14 +210,36 @@ func (ingest *Ingest) validateStringResetSignature(r, s string) error {
 		return errors.New("bad s value")
 	}
 
-	return ingest.validateResetSignature(rInt, sInt)
+	return ingest.validateResetSignature(resetToken, rInt, sInt)
 }
 
-func (ingest *Ingest) GetResetChallenge() string {
-	return fmt.Sprintf("%064s", big.NewInt(0).SetBytes(ingest.resetToken[:]).Text(16))
+// GetResetChallenge returns the current challenge of a device, generating one if the device has none or if it expired.
+// Challenges last for INGEST_RESET_CHALLENGE_TTL (1m) and up to INGEST_MAX_RESET_CHALLENGES (1024) of them can be
+// outstanding at once, the oldest one is dropped to make room for a new one.
+func (ingest *Ingest) GetResetChallenge(deviceID string) (string, error) {
+	if err := ValidateDeviceID(deviceID); err != nil {
+		return "", err
+	}
+
+	ingest.sessionsMutex.Lock()
+	defer ingest.sessionsMutex.Unlock()
+
+	resetToken, err := ingest.resetChallenges.issue(deviceID, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%064s", big.NewInt(0).SetBytes(resetToken[:]).Text(16)), nil
 }
 
-func (ingest *Ingest) ResetChallengeResponse(body string) error {
+// ResetChallengeResponse verifies the signed challenge of a device and starts a new session for it that uses the
+// generator named `rngAlgorithm` (one of rng.Generators32()) for anti-replay.
+// Sessions of other devices are left untouched.
+func (ingest *Ingest) ResetChallengeResponse(deviceID string, body string, rngAlgorithm string) error {
+	if err := ValidateDeviceID(deviceID); err != nil {
+		return err
+	}
+
 	if len(body) != 128 {
 		return errors.New(fmt.Sprintf("bad body length (expected 128, got %d)", len(body)))
 	}
@@ -180,93 +247,286 @@ func (ingest *Ingest) ResetChallengeResponse(body string) error {
 	r := string(body[0:64])
 	s := string(body[64:128])
 
-	if err := ingest.validateStringResetSignature(r, s); err != nil {
+	ingest.sessionsMutex.Lock()
+	defer ingest.sessionsMutex.Unlock()
+
+	resetToken, ok := ingest.resetChallenges.get(deviceID, time.Now())
+	if !ok {
+		return errors.New(fmt.Sprintf("no challenge was issued for device \"%s\" or it expired", deviceID))
+	}
+
+	if err := ingest.validateStringResetSignature(resetToken, r, s); err != nil {
 		return err
 	}
 
-	ingest.state.sessionID = 0
-	ingest.state.initialRNGVector = [4]uint32{rand.Uint32(), rand.Uint32(), rand.Uint32(), rand.Uint32()}
-	//ingest.state.nextSequenceID = 0
-	//ingest.state.rngVector = ingest.state.initialRNGVector
+	rngVector, err := generateRNGVector(rngAlgorithm)
+	if err != nil {
+		return err
+	}
 
-	rows, err := ingest.db.Query(
-		"insert into sessions (prng, challenge, csig_r, csig_s) values (?, ?, ?, ?) returning session_id",
-		util.ArrayToString(ingest.state.initialRNGVector[:]),
-		util.ArrayToString(ingest.resetToken[:]),
-		r, s)
+	session, err := newState(deviceID, 0, rngAlgorithm, rngVector)
+	if err != nil {
+		return err
+	}
+
+	if err := ingest.insertSession(session, resetToken, r, s); err != nil {
+		return err
+	}
 
+	if previous := ingest.sessions[deviceID]; previous != nil {
+		if err := ingest.persistSessionStats(previous); err != nil {
+			log.Printf("Failed to persist the statistics of session %d: %s", previous.sessionID, err)
+		}
+
+		if previous.inFlight != 0 {
+			ingest.retiredSessions = append(ingest.retiredSessions, previous)
+		}
+	}
+
+	ingest.sessions[deviceID] = session
+	ingest.resetChallenges.remove(deviceID)
+
+	return nil
+}
+
+// insertSession closes the previous sessions of the device and records the new one, filling in its id.
+func (ingest *Ingest) insertSession(session *state, resetToken [32]uint8, r, s string) error {
+	tx, err := ingest.db.Begin()
 	if err != nil {
 		return err
 	}
 
-	defer rows.Close()
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(ingest.db.Rebind("update sessions set closed = 1 where device_id = ? and closed = 0"), session.deviceID); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(
+		ingest.db.Rebind("insert into sessions (device_id, prng, prng_algorithm, challenge, csig_r, csig_s) values (?, ?, ?, ?, ?, ?) returning session_id"),
+		session.deviceID,
+		util.ArrayToString(session.initialRNGVector),
+		session.rngAlgorithm,
+		util.ArrayToString(resetToken[:]),
+		r, s)
+
+	if err != nil {
+		return err
+	}
 
 	if !rows.Next() {
+		_ = rows.Close()
 		return errors.New("no rows returned from sql insert query")
 	}
 
-	if err := rows.Scan(&ingest.state.sessionID); err != nil {
+	if err = rows.Scan(&session.sessionID); err != nil {
+		_ = rows.Close()
 		return err
 	}
 
-	ingest.resetResetToken()
+	if err = rows.Close(); err != nil {
+		return err
+	}
 
-	return nil
+	return tx.Commit()
+}
+
+// getSession returns the active session of a device or nil if the device has no session.
+func (ingest *Ingest) getSession(deviceID string) *state {
+	ingest.sessionsMutex.Lock()
+	defer ingest.sessionsMutex.Unlock()
+
+	return ingest.sessions[deviceID]
 }
 
-func (ingest *Ingest) SessionID() uint {
-	return ingest.state.sessionID
+// acquireSession returns the active session of a device and counts a batch of it as in flight, or nil if the device
+// has no session. The batch is counted as done by releaseSession.
+func (ingest *Ingest) acquireSession(deviceID string) *state {
+	ingest.sessionsMutex.Lock()
+	defer ingest.sessionsMutex.Unlock()
+
+	session := ingest.sessions[deviceID]
+	if session != nil {
+		session.inFlight++
+	}
+
+	return session
 }
 
-func (ingest *Ingest) GetInitialRNGVector() string {
-	return fmt.Sprintf("%08x%08x%08x%08x",
-		ingest.state.initialRNGVector[0],
-		ingest.state.initialRNGVector[1],
-		ingest.state.initialRNGVector[2],
-		ingest.state.initialRNGVector[3])
+func (ingest *Ingest) releaseSession(session *state) {
+	ingest.sessionsMutex.Lock()
+	defer ingest.sessionsMutex.Unlock()
+
+	session.inFlight--
 }
 
-func (ingest *Ingest) NewPackets(packets []common.Packet) error {
-	ingest.incomingPackets <- packets
-	return nil
+// BusHealth returns the state of the connection that packets are published through
+func (ingest *Ingest) BusHealth() common.BusHealth {
+	return ingest.bus.Health()
 }
 
-// Start starts a certain number of worker threads for incoming packet batches.
-// If `numThreads` is greater than 1, the data in the database will be inserted out of order.
-// Honestly just pass in 1, to be safe...
-func (ingest *Ingest) Start(numThreads uint) {
-	ingest.packetProcessorWG.Add(int(numThreads))
+// SessionID returns the id of the active session of a device, or 0 if there is none.
+func (ingest *Ingest) SessionID(deviceID string) uint {
+	if session := ingest.getSession(deviceID); session != nil {
+		return session.sessionID
+	}
+
+	return 0
+}
 
-	for i := uint(0); i < numThreads; i++ {
-		go ingest.task()
+func (ingest *Ingest) GetInitialRNGVector(deviceID string) string {
+	session := ingest.getSession(deviceID)
+	if session == nil {
+		return ""
 	}
+
+	return util.ArrayToString(session.initialRNGVector)
 }
 
-func (ingest *Ingest) Stop() {
-	close(ingest.incomingPackets)
-	ingest.packetProcessorWG.Wait()
+// RNGAlgorithm returns the name of the generator used by the active session of a device.
+func (ingest *Ingest) RNGAlgorithm(deviceID string) string {
+	if session := ingest.getSession(deviceID); session != nil {
+		return session.rngAlgorithm
+	}
+
+	return ""
 }
 
-func (ingest *Ingest) newPacket(packet *common.Packet) error {
-	/*if packet.SequenceID < ingest.state.nextSequenceID {
-		return errors.New(fmt.Sprintf("old sequence ID (got: %d, expected (at least): %d)",
-			packet.SequenceID,
-			ingest.state.nextSequenceID))
-	}*/
+// sessionStatsColumns are the columns of the sessions table that hold SessionStats, in the order of its fields
+const sessionStatsColumns = "received_packets, highest_sequence_id, dropped_packets, duplicate_packets, out_of_order_packets"
+
+// SessionStats returns the link statistics of the active session of a device.
+func (ingest *Ingest) SessionStats(deviceID string) (SessionStats, error) {
+	session := ingest.getSession(deviceID)
+	if session == nil {
+		return SessionStats{}, errors.New(fmt.Sprintf("device \"%s\" has no active session", deviceID))
+	}
+
+	return session.getStats(), nil
+}
+
+// StoredSessionStats returns the link statistics of any session, active or not, as last persisted to the database.
+func (ingest *Ingest) StoredSessionStats(sessionID uint) (SessionStats, error) {
+	stats := SessionStats{SessionID: sessionID}
+
+	row := ingest.db.QueryRow(ingest.db.Rebind("select device_id, "+sessionStatsColumns+" from sessions where session_id = ?"), sessionID)
+	if err := row.Scan(
+		&stats.DeviceID,
+		&stats.ReceivedPackets, &stats.HighestSequenceID, &stats.DroppedPackets, &stats.DuplicatePackets, &stats.OutOfOrderPackets,
+	); err != nil {
+		return SessionStats{}, err
+	}
+
+	return stats, nil
+}
+
+// persistSessionStats writes the link statistics of a session to its row in the sessions table
+func (ingest *Ingest) persistSessionStats(session *state) error {
+	return ingest.writeSessionStats(session.getStats())
+}
+
+func (ingest *Ingest) writeSessionStats(stats SessionStats) error {
+	_, err := ingest.db.Exec(
+		ingest.db.Rebind("update sessions set received_packets = ?, highest_sequence_id = ?, dropped_packets = ?, duplicate_packets = ?, out_of_order_packets = ? where session_id = ?"),
+		stats.ReceivedPackets, stats.HighestSequenceID, stats.DroppedPackets, stats.DuplicatePackets, stats.OutOfOrderPackets,
+		stats.SessionID)
+
+	return err
+}
+
+// NewPackets processes a batch of packets from a device and reports which of them were accepted.
+// An error is returned only if the batch as a whole was rejected, for the reason returned alongside it. The batch is
+// rejected as RejectedBusy if it isn't published within INGEST_RESULT_TIMEOUT (10s) or before `ctx` is done, it may
+// still be published afterwards and is then dropped as a duplicate when the device retransmits it.
+func (ingest *Ingest) NewPackets(ctx context.Context, deviceID string, packets []common.Packet) (Ack, RejectionReason, error) {
+	if err := ValidateDeviceID(deviceID); err != nil {
+		return Ack{}, RejectedParse, err
+	}
+
+	if ingest.getSession(deviceID) == nil {
+		return Ack{}, RejectedNoSession, errors.New(fmt.Sprintf("device \"%s\" has no active session", deviceID))
+	}
+
+	result := make(chan batchResult, 1)
+
+	ingest.stopMutex.RLock()
+
+	if ingest.stopped {
+		ingest.stopMutex.RUnlock()
+		return Ack{}, RejectedBusy, errors.New("the ingester is shutting down")
+	}
+
+	err := ingest.enqueue(packetBatch{
+		deviceID: deviceID,
+		packets:  packets,
+
+		result: result,
+	})
+
+	ingest.stopMutex.RUnlock()
+
+	if err != nil {
+		return Ack{}, RejectedBusy, err
+	}
+
+	timer := time.NewTimer(ingest.queueConfig.resultTimeout)
+	defer timer.Stop()
+
+	var res batchResult
+
+	select {
+	case res = <-result:
+	case <-timer.C:
+		return Ack{}, RejectedBusy, errors.New("timed out waiting for the batch to be published")
+	case <-ctx.Done():
+		return Ack{}, RejectedBusy, ctx.Err()
+	}
+
+	if res.err != nil {
+		return res.ack, res.reason, res.err
+	}
+
+	return res.ack, "", nil
+}
+
+// Start starts `numWorkers` goroutines that verify and encode incoming packet batches in parallel.
+// Batches are published in the order they arrived in regardless of the number of workers.
+func (ingest *Ingest) Start(numWorkers uint) {
+	if numWorkers == 0 {
+		numWorkers = 1
+	}
+
+	ingest.startPipeline(numWorkers, ingest.publishTask)
+
+	ingest.statsWG.Add(1)
+	go ingest.statsTask()
+}
 
-	//seqDelta := packet.SequenceID - ingest.state.nextSequenceID + 1
-	snapshot := ingest.state
+// Stop drains the batches that were already queued and persists the session statistics.
+// Batches passed to NewPackets after Stop was called are rejected as RejectedBusy.
+func (ingest *Ingest) Stop(ctx context.Context) error {
+	ingest.stopMutex.Lock()
+	ingest.stopped = true
+	close(ingest.incomingPackets)
+	ingest.stopMutex.Unlock()
+	drainErr := common.WaitContext(ctx, ingest.packetProcessorWG.Wait)
 
-	//expectedRNG := uint32(0)
-	//for i := uint(0); i < seqDelta; i++ {
-	//	expectedRNG = ingest.state.advance()
-	//}
+	// the statistics are persisted even if draining took too long
+	close(ingest.stopStats)
+	if err := common.WaitContext(ctx, ingest.statsWG.Wait); err != nil {
+		return err
+	}
 
-	expectedRNG := ingest.state.getNthRNG(packet.SequenceID)
+	return drainErr
+}
 
-	if packet.RNGState != expectedRNG {
-		ingest.state = snapshot
+// Close closes the database connection of the ingester, it should be called after Stop
+func (ingest *Ingest) Close() error {
+	return ingest.db.Close()
+}
 
+func (ingest *Ingest) newPacket(session *state, packet *common.Packet) error {
+	if expectedRNG, ok := session.verifyRNG(packet.SequenceID, packet.RNGState); !ok {
 		return errors.New(fmt.Sprintf("bad pRNG state (!) (got: %d, expected: %d)", packet.RNGState, expectedRNG))
 	}
 
@@ -275,8 +535,9 @@ func (ingest *Ingest) newPacket(packet *common.Packet) error {
 	//state.delayAveragingWindow[state.delayWindowPointer%len(state.delayAveragingWindow)] = currentDelay
 	//state.delayWindowPointer++
 
-	//ingest.state.droppedPacketCt += seqDelta - 1
-	//state.lastFullPacket = *packet
+	if session.isDuplicate(packet.SequenceID) {
+		return errDuplicatePacket
+	}
 
 	//state.lastPacket = *packet
 	if inner, ok := packet.Inner.(common.FullPacket); ok {
@@ -302,7 +563,8 @@ func (ingest *Ingest) newPacket(packet *common.Packet) error {
 			maxC = math.Max(maxC, float64(v))
 		}
 
-		log.Printf("%d @ %f (fill: %d): %d (%d/%d), %f RPM, %f km/h, @ (%f, %f), %f/%f/%f V %f/%f°C (H: %f°C, %f ppm) %f A",
+		log.Printf("%s/%d @ %f (fill: %d): %d (%d/%d), %f RPM, %f km/h, @ (%f, %f), %f/%f/%f V %f/%f°C (H: %f°C, %f ppm) %f A",
+			session.deviceID,
 			packet.SequenceID,
 			float32(inner.TickCounter)/1000.,
 			inner.QueueFillAmount,
@@ -325,76 +587,22 @@ func (ingest *Ingest) newPacket(packet *common.Packet) error {
 		//state.lastFullPacket = *packet
 	}
 
-	return nil
-}
-
-func (ingest *Ingest) processPacketBatch(batch []common.Packet, amqpChan *amqp.Channel, amqpExchange string) error {
-	log.Printf("%d new packets", len(batch))
-
-	for _, packet := range batch {
-		/*marshalled, _ := json.Marshal(packet.PacketData)
-		_, err := stmt.Exec(state.sessionNo, packet.SequenceID, packet.Timestamp, string(marshalled))*/
-
-		var err error
-
-		if err = ingest.newPacket(&packet); err != nil {
-			return err
-		}
+	if inner, ok := packet.Inner.(common.EssentialsPacket); ok {
+		maxC := -math.MaxFloat64
 
-		var marshalledPacket bytes.Buffer
-		packetEncoder := gob.NewEncoder(&marshalledPacket)
-		if err = packetEncoder.Encode(common.AMQPPacket{
-			SessionID: ingest.SessionID(),
-			Packet:    packet,
-		}); err != nil {
-			return err
+		for _, v := range inner.BatteryTemperatures {
+			maxC = math.Max(maxC, float64(v))
 		}
 
-		if err = amqpChan.Publish(
-			amqpExchange,
-			"",
-			true,
-			false,
-			amqp.Publishing{
-				ContentType: "application/octet-stream",
-				Body:        marshalledPacket.Bytes(),
-			}); err != nil {
-			return err
-		}
+		log.Printf("%s/%d (essentials): %f km/h, %f V, %f Wh, %f°C",
+			session.deviceID,
+			packet.SequenceID,
+			inner.Speed,
+			inner.Voltage,
+			inner.RemainingWattHours,
+			maxC,
+		)
 	}
 
 	return nil
 }
-
-func (ingest *Ingest) task() {
-	defer ingest.packetProcessorWG.Done()
-
-	var err error
-	var amqpChan *amqp.Channel
-
-	if amqpChan, err = ingest.amqpConn.Channel(); err != nil {
-		log.Fatalf("Failed to establish an amqp channel: %s", err)
-		return
-	}
-
-	defer amqpChan.Close()
-
-	if err = amqpChan.ExchangeDeclare(
-		"full_packets", // name
-		"fanout",       // type
-		true,           // durable
-		false,          // auto-deleted
-		false,          // internal
-		false,          // no-wait
-		nil,            // arguments
-	); err != nil {
-		log.Fatalf("Failed to declare an amqp exchange: %s", err)
-		return
-	}
-
-	for batch := range ingest.incomingPackets {
-		if err := ingest.processPacketBatch(batch, amqpChan, "full_packets"); err != nil {
-			log.Printf("Error while processing a batch of %d packets: %s", len(batch), err)
-		}
-	}
-}
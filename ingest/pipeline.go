@@ -0,0 +1,255 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xor-shift/teleserver/common"
+	"log"
+	"time"
+)
+
+// batchJob is a batch of packets on its way through the processing pipeline.
+//
+// The dispatcher hands every job to one of the verification workers and, in the order the batches arrived in, to the
+// publisher. The publisher waits for each job to be verified before publishing it so that the order is kept no matter
+// which worker finishes first.
+type batchJob struct {
+	batch   packetBatch
+	session *state
+	err     error
+
+	ack Ack
+	// verified holds the encoded packets that passed verification, in the order they were in the batch
+	verified []verifiedPacket
+
+	// done is closed once the job was verified
+	done chan struct{}
+}
+
+type verifiedPacket struct {
+	sequenceID uint
+	message    common.Message
+}
+
+// startPipeline starts the dispatcher, `numWorkers` verification workers and `publishTask`
+func (ingest *Ingest) startPipeline(numWorkers uint, publishTask func(pending <-chan *batchJob)) {
+	jobs := make(chan *batchJob)
+	pending := make(chan *batchJob, 2*numWorkers)
+
+	ingest.packetProcessorWG.Add(int(numWorkers) + 2)
+
+	go func() {
+		defer ingest.packetProcessorWG.Done()
+		ingest.dispatch(jobs, pending)
+	}()
+
+	for i := uint(0); i < numWorkers; i++ {
+		go func() {
+			defer ingest.packetProcessorWG.Done()
+			ingest.verifyTask(jobs)
+		}()
+	}
+
+	go func() {
+		defer ingest.packetProcessorWG.Done()
+		publishTask(pending)
+	}()
+}
+
+func (ingest *Ingest) dispatch(jobs chan<- *batchJob, pending chan<- *batchJob) {
+	defer close(jobs)
+	defer close(pending)
+
+	for batch := range ingest.incomingPackets {
+		job := &batchJob{
+			batch: batch,
+			done:  make(chan struct{}),
+		}
+
+		pending <- job
+		jobs <- job
+	}
+}
+
+func (ingest *Ingest) verifyTask(jobs <-chan *batchJob) {
+	for job := range jobs {
+		ingest.verifyBatch(job)
+		close(job.done)
+	}
+}
+
+// verifyBatch checks and encodes every packet of a batch, nothing is recorded as seen until the batch is published
+func (ingest *Ingest) verifyBatch(job *batchJob) {
+	batch := job.batch
+
+	log.Printf("%d new packets from %s", len(batch.packets), batch.deviceID)
+
+	session := ingest.acquireSession(batch.deviceID)
+	if session == nil {
+		job.err = errors.New(fmt.Sprintf("device \"%s\" has no active session", batch.deviceID))
+		return
+	}
+
+	job.session = session
+	job.ack = Ack{Rejections: []PacketRejection{}}
+
+	for _, packet := range batch.packets {
+		var err error
+
+		if err = ingest.newPacket(session, &packet); errors.Is(err, errDuplicatePacket) {
+			log.Printf("%s/%d: dropped duplicate packet", session.deviceID, packet.SequenceID)
+			job.ack.reject(packet.SequenceID, RejectedDuplicate)
+			continue
+		} else if err != nil {
+			log.Printf("%s/%d: %s", session.deviceID, packet.SequenceID, err)
+			job.ack.reject(packet.SequenceID, RejectedBadRNG)
+			continue
+		}
+
+		message, err := common.NewPacketMessage(common.AMQPPacket{
+			DeviceID:  session.deviceID,
+			SessionID: session.sessionID,
+			Packet:    packet,
+		}, ingest.packetFormat)
+		if err != nil {
+			log.Printf("%s/%d: failed to encode: %s", session.deviceID, packet.SequenceID, err)
+			job.ack.reject(packet.SequenceID, RejectedInternal)
+			continue
+		}
+
+		job.verified = append(job.verified, verifiedPacket{
+			sequenceID: packet.SequenceID,
+			message:    message,
+		})
+	}
+}
+
+// publishJobs publishes the verified packets of every job in order.
+// Packets are recorded as seen only once the bus took responsibility for them so that the ones that failed can be
+// retransmitted. The statistics of a session are passed to `persist` before a batch that got packets accepted is acked,
+// the highest sequence id among them is what keeps a restarted producer from accepting replays of those packets.
+func (ingest *Ingest) publishJobs(pending <-chan *batchJob, publish func(messages []common.Message) []error, persist func(session *state) error) {
+	for job := range pending {
+		<-job.done
+
+		if job.err != nil {
+			log.Printf("Error while processing a batch of %d packets from %s: %s", len(job.batch.packets), job.batch.deviceID, job.err)
+
+			job.batch.result <- batchResult{
+				ack:    Ack{HighestContiguousSequenceID: -1},
+				reason: RejectedNoSession,
+				err:    job.err,
+			}
+			continue
+		}
+
+		session := job.session
+
+		var packets []verifiedPacket
+		var messages []common.Message
+		inBatch := map[uint]bool{}
+
+		for _, packet := range job.verified {
+			// copies of a packet may have been verified concurrently in different batches, or be in the same batch
+			duplicate := inBatch[packet.sequenceID]
+			if duplicate {
+				session.countDuplicate()
+			} else {
+				duplicate = session.isDuplicate(packet.sequenceID)
+			}
+
+			if duplicate {
+				log.Printf("%s/%d: dropped duplicate packet", session.deviceID, packet.sequenceID)
+				job.ack.reject(packet.sequenceID, RejectedDuplicate)
+				continue
+			}
+
+			inBatch[packet.sequenceID] = true
+			packets = append(packets, packet)
+			messages = append(messages, packet.message)
+		}
+
+		if len(packets) != 0 {
+			for i, err := range publish(messages) {
+				packet := packets[i]
+
+				if err != nil {
+					log.Printf("%s/%d: failed to publish: %s", session.deviceID, packet.sequenceID, err)
+					job.ack.reject(packet.sequenceID, RejectedInternal)
+					continue
+				}
+
+				session.recordSequenceID(packet.sequenceID)
+				job.ack.Accepted++
+			}
+		}
+
+		if job.ack.Accepted != 0 {
+			if err := persist(session); err != nil {
+				log.Printf("Failed to persist the statistics of session %d: %s", session.sessionID, err)
+			}
+		}
+
+		job.ack.HighestContiguousSequenceID = session.highestContiguousSequenceID()
+		ingest.releaseSession(session)
+
+		job.batch.result <- batchResult{ack: job.ack}
+	}
+}
+
+// publishTask publishes to the bus, packets that come in while the bus is down or that it doesn't take responsibility
+// for are rejected as RejectedInternal for the devices to retransmit them later
+func (ingest *Ingest) publishTask(pending <-chan *batchJob) {
+	ingest.publishJobs(pending, ingest.bus.Publish, ingest.persistSessionStats)
+}
+
+// statsTask periodically persists the link statistics of the sessions that changed
+func (ingest *Ingest) statsTask() {
+	defer ingest.statsWG.Done()
+
+	ticker := time.NewTicker(ingest.statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ingest.persistDirtyStats()
+		case <-ingest.stopStats:
+			ingest.persistDirtyStats()
+			return
+		}
+	}
+}
+
+// persistDirtyStats persists the statistics of the active sessions and of the retired ones. A retired session is
+// persisted one last time once it has no batches in flight, its statistics don't change after that.
+func (ingest *Ingest) persistDirtyStats() {
+	ingest.sessionsMutex.Lock()
+	sessions := make([]*state, 0, len(ingest.sessions)+len(ingest.retiredSessions))
+	for _, session := range ingest.sessions {
+		sessions = append(sessions, session)
+	}
+
+	retired := ingest.retiredSessions[:0]
+	for _, session := range ingest.retiredSessions {
+		sessions = append(sessions, session)
+
+		if session.inFlight != 0 {
+			retired = append(retired, session)
+		}
+	}
+
+	ingest.retiredSessions = retired
+	ingest.sessionsMutex.Unlock()
+
+	for _, session := range sessions {
+		stats, dirty := session.takeDirtyStats()
+		if !dirty {
+			continue
+		}
+
+		if err := ingest.writeSessionStats(stats); err != nil {
+			log.Printf("Failed to persist the statistics of session %d: %s", stats.SessionID, err)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package ingest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/xor-shift/teleserver/common"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// packets are logged one by one
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func newTestIngest(devices ...string) *Ingest {
+	ingest := &Ingest{
+		sessionsMutex:     &sync.Mutex{},
+		sessions:          map[string]*state{},
+		packetFormat:      common.PacketFormatJSON,
+		packetProcessorWG: &sync.WaitGroup{},
+		incomingPackets:   make(chan packetBatch, 128),
+	}
+
+	for i, deviceID := range devices {
+		session, _ := newState(deviceID, uint(i+1), DefaultRNGAlgorithm, testRNGVector)
+		ingest.sessions[deviceID] = session
+	}
+
+	return ingest
+}
+
+// noPersist stands in for persisting the statistics of sessions, the tests have no database
+func noPersist(*state) error {
+	return nil
+}
+
+// newTestBatches splits `count` valid packets of a device into batches of `batchSize`
+func newTestBatches(deviceID string, count int, batchSize int) []packetBatch {
+	var batches []packetBatch
+
+	session, _ := newState(deviceID, 0, DefaultRNGAlgorithm, testRNGVector)
+
+	for i := 0; i < count; i += batchSize {
+		batch := packetBatch{
+			deviceID: deviceID,
+			result:   make(chan batchResult, 1),
+		}
+
+		for j := i; j < i+batchSize && j < count; j++ {
+			batch.packets = append(batch.packets, common.Packet{
+				PacketHeader: common.PacketHeader{
+					SequenceID: uint(j),
+					RNGState:   session.getNthRNG(uint(j)),
+				},
+				Inner: common.FullPacket{},
+			})
+		}
+
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+func TestPipelineOrder(t *testing.T) {
+	const count = 4096
+
+	ingest := newTestIngest("test")
+
+	var published []uint
+	ingest.startPipeline(8, func(pending <-chan *batchJob) {
+		ingest.publishJobs(pending, func(messages []common.Message) []error {
+			errs := make([]error, len(messages))
+
+			for i, message := range messages {
+				var amqpPacket common.AMQPPacket
+				amqpPacket, errs[i] = common.ParseMessage(message)
+				published = append(published, amqpPacket.Packet.SequenceID)
+
+				if expected := "telemetry.test.1.full"; message.RoutingKey != expected {
+					t.Errorf("expected routing key %s got %s", expected, message.RoutingKey)
+				}
+			}
+
+			return errs
+		}, noPersist)
+	})
+
+	batches := newTestBatches("test", count, 3)
+
+	go func() {
+		for _, batch := range batches {
+			ingest.incomingPackets <- batch
+		}
+	}()
+
+	for i, batch := range batches {
+		if result := <-batch.result; result.err != nil || result.ack.Rejected != 0 {
+			t.Fatalf("batch %d: %+v", i, result)
+		}
+	}
+
+	close(ingest.incomingPackets)
+	ingest.packetProcessorWG.Wait()
+
+	for i, sequenceID := range published {
+		if sequenceID != uint(i) {
+			t.Fatalf("packet %d was published as #%d", sequenceID, i)
+		}
+	}
+
+	if stats := ingest.sessions["test"].getStats(); stats.ReceivedPackets != count || stats.DroppedPackets != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+// packets the broker didn't confirm must be accepted when they're retransmitted
+func TestPipelineUnconfirmed(t *testing.T) {
+	ingest := newTestIngest("test")
+
+	confirm := false
+	ingest.startPipeline(2, func(pending <-chan *batchJob) {
+		ingest.publishJobs(pending, func(messages []common.Message) []error {
+			errs := make([]error, len(messages))
+			for i := range errs {
+				if !confirm {
+					errs[i] = errors.New("not confirmed")
+				}
+			}
+
+			return errs
+		}, noPersist)
+	})
+
+	batch := newTestBatches("test", 4, 4)[0]
+
+	ingest.incomingPackets <- batch
+	if result := <-batch.result; result.ack.Accepted != 0 || result.ack.Rejected != 4 || result.ack.Rejections[0].Reason != RejectedInternal {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	confirm = true
+
+	ingest.incomingPackets <- batch
+	if result := <-batch.result; result.ack.Accepted != 4 || result.ack.HighestContiguousSequenceID != 3 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	close(ingest.incomingPackets)
+	ingest.packetProcessorWG.Wait()
+}
+
+// copies of a packet within a batch are counted as duplicates like the ones from other batches
+func TestPipelineDuplicates(t *testing.T) {
+	ingest := newTestIngest("test")
+	ingest.startPipeline(2, func(pending <-chan *batchJob) {
+		ingest.publishJobs(pending, func(messages []common.Message) []error { return make([]error, len(messages)) }, noPersist)
+	})
+
+	batch := newTestBatches("test", 2, 2)[0]
+	batch.packets = append(batch.packets, batch.packets[1])
+
+	ingest.incomingPackets <- batch
+	if result := <-batch.result; result.ack.Accepted != 2 || result.ack.Rejected != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	ingest.incomingPackets <- batch
+	if result := <-batch.result; result.ack.Accepted != 0 || result.ack.Rejected != 3 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	close(ingest.incomingPackets)
+	ingest.packetProcessorWG.Wait()
+
+	if stats := ingest.sessions["test"].getStats(); stats.ReceivedPackets != 2 || stats.DuplicatePackets != 4 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+// the pipeline runs end to end through the in-memory bus, consumers only get the packets their bindings match
+func TestPipelineMemoryBus(t *testing.T) {
+	const count = 64
+
+	bus := common.NewMemoryBus(0, 0)
+	defer bus.Close()
+
+	ingest := newTestIngest("a", "b")
+	ingest.bus = bus
+
+	received := make(chan common.AMQPPacket, 2*count)
+	subscription, err := bus.Subscribe(common.QueueConfig{
+		Exchange:     common.PacketExchange,
+		ExchangeType: common.PacketExchangeType,
+
+		Bindings: []string{common.PacketBindingPattern("b", common.PacketTypeFull)},
+	}, "test", common.AckingHandler(func(delivery *common.Delivery) error {
+		amqpPacket, err := common.ParseMessage(delivery.Message)
+		if err != nil {
+			return common.Permanent(err)
+		}
+
+		received <- amqpPacket
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ingest.startPipeline(2, func(pending <-chan *batchJob) {
+		ingest.publishJobs(pending, bus.Publish, noPersist)
+	})
+
+	// nothing is bound to the packets of "a", they are rejected for the device to retransmit them later
+	batchA := newTestBatches("a", 1, 1)[0]
+	ingest.incomingPackets <- batchA
+	if result := <-batchA.result; result.ack.Rejected != 1 || result.ack.Rejections[0].Reason != RejectedInternal {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	for _, batch := range newTestBatches("b", count, 8) {
+		ingest.incomingPackets <- batch
+		if result := <-batch.result; result.err != nil || result.ack.Accepted != uint(len(batch.packets)) {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	}
+
+	close(ingest.incomingPackets)
+	ingest.packetProcessorWG.Wait()
+
+	for i := 0; i < count; i++ {
+		amqpPacket := <-received
+		if amqpPacket.DeviceID != "b" || amqpPacket.SessionID != 2 || amqpPacket.Packet.SequenceID != uint(i) {
+			t.Fatalf("packet %d: unexpected %+v", i, amqpPacket)
+		}
+	}
+
+	if err = common.ShutdownSubscription(context.Background(), subscription); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestSignedBodies signs the packets of the batches returned by newTestBatches the way devices post them
+func newTestSignedBodies(key *ecdsa.PrivateKey, deviceID string, count int, batchSize int) [][]byte {
+	var bodies [][]byte
+
+	for _, batch := range newTestBatches(deviceID, count, batchSize) {
+		var body strings.Builder
+
+		body.WriteString("[")
+		for j, packet := range batch.packets {
+			if j != 0 {
+				body.WriteString(", ")
+			}
+
+			body.WriteString(fmt.Sprintf(`{"seq": %d, "ts": 1680000000, "rng": %d, "data": {}}`, packet.SequenceID, packet.RNGState))
+		}
+		body.WriteString("]")
+
+		hash := sha256.Sum256([]byte(body.String()))
+		r, s, _ := ecdsa.Sign(rand.Reader, key, hash[:])
+
+		bodies = append(bodies, []byte(fmt.Sprintf("%s%064x%064x", body.String(), r, s)))
+	}
+
+	return bodies
+}
+
+// BenchmarkPipeline measures parsing and publishing signed batches of 8 packets posted by several devices. Every
+// device parses its bodies in a goroutine of its own the way the HTTP handlers do and waits for the ack of a batch
+// before posting the next one, the pipeline then verifies, encodes and publishes them to a bus that confirms
+// everything right away.
+//
+// Parsing, signature included, is most of the work and happens before the batches are queued, the workers only share
+// the verification and the encoding.
+func BenchmarkPipeline(b *testing.B) {
+	const batchSize = 8
+
+	devices := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, numWorkers := range []uint{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", numWorkers), func(b *testing.B) {
+			ingest := newTestIngest(devices...)
+			ingest.startPipeline(numWorkers, func(pending <-chan *batchJob) {
+				ingest.publishJobs(pending, func(messages []common.Message) []error { return make([]error, len(messages)) }, noPersist)
+			})
+
+			perDevice := (b.N + len(devices) - 1) / len(devices)
+
+			bodies := make([][][]byte, len(devices))
+			for i, deviceID := range devices {
+				bodies[i] = newTestSignedBodies(key, deviceID, perDevice*batchSize, batchSize)
+			}
+
+			errs := make(chan error, len(devices))
+			wg := &sync.WaitGroup{}
+
+			b.ResetTimer()
+			start := time.Now()
+
+			for i, deviceID := range devices {
+				wg.Add(1)
+
+				go func(deviceID string, bodies [][]byte) {
+					defer wg.Done()
+
+					for _, body := range bodies {
+						packets, err := common.ParsePackets[common.FullPacket](body, key.PublicKey)
+						if err != nil {
+							errs <- err
+							return
+						}
+
+						batch := packetBatch{
+							deviceID: deviceID,
+							packets:  packets,
+							result:   make(chan batchResult, 1),
+						}
+
+						ingest.incomingPackets <- batch
+						if result := <-batch.result; result.err != nil || result.ack.Accepted != batchSize {
+							errs <- errors.New(fmt.Sprintf("unexpected result %+v", result))
+							return
+						}
+					}
+				}(deviceID, bodies[i])
+			}
+
+			wg.Wait()
+
+			elapsed := time.Since(start)
+			b.StopTimer()
+
+			close(ingest.incomingPackets)
+			ingest.packetProcessorWG.Wait()
+
+			close(errs)
+			for err := range errs {
+				b.Fatal(err)
+			}
+
+			b.ReportMetric(float64(len(devices)*perDevice*batchSize)/elapsed.Seconds(), "packets/s")
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xor-shift/teleserver/util"
+	"sync/atomic"
+	"time"
+)
+
+// OverloadPolicy decides what happens to a batch of packets that arrives while the processing queue is full
+type OverloadPolicy string
+
+const (
+	// OverloadBlock waits for room in the queue for up to INGEST_BLOCK_TIMEOUT before giving up on the batch
+	OverloadBlock OverloadPolicy = "block"
+	// OverloadShedOldest drops the oldest queued batch to make room for the new one
+	OverloadShedOldest OverloadPolicy = "shed_oldest"
+	// OverloadReject gives up on the new batch immediately
+	OverloadReject OverloadPolicy = "reject"
+)
+
+// errBusy is returned for batches that were given up on because of the overload policy
+var errBusy = errors.New("packet queue is full")
+
+type queueConfig struct {
+	size         uint
+	policy       OverloadPolicy
+	blockTimeout time.Duration
+	// resultTimeout is how long NewPackets waits for a queued batch to be published
+	resultTimeout time.Duration
+}
+
+// queueConfigFromEnv reads the queue configuration from INGEST_QUEUE_SIZE, INGEST_OVERLOAD_POLICY,
+// INGEST_BLOCK_TIMEOUT and INGEST_RESULT_TIMEOUT
+func queueConfigFromEnv() (queueConfig, error) {
+	var err error
+
+	config := queueConfig{
+		policy: OverloadPolicy(util.GetenvDefault("INGEST_OVERLOAD_POLICY", string(OverloadBlock))),
+	}
+
+	switch config.policy {
+	case OverloadBlock, OverloadShedOldest, OverloadReject:
+	default:
+		return queueConfig{}, errors.New(fmt.Sprintf("bad overload policy \"%s\"", config.policy))
+	}
+
+	if config.size, err = util.GetenvUint("INGEST_QUEUE_SIZE", 128); err != nil {
+		return queueConfig{}, err
+	}
+
+	if config.size == 0 {
+		return queueConfig{}, errors.New("the packet queue must have room for at least one batch")
+	}
+
+	if config.blockTimeout, err = util.GetenvDuration("INGEST_BLOCK_TIMEOUT", 5*time.Second); err != nil {
+		return queueConfig{}, err
+	}
+
+	if config.resultTimeout, err = util.GetenvDuration("INGEST_RESULT_TIMEOUT", 10*time.Second); err != nil {
+		return queueConfig{}, err
+	}
+
+	return config, nil
+}
+
+// QueueMetrics describes how close the processing queue is to saturation
+type QueueMetrics struct {
+	Policy   OverloadPolicy `json:"policy"`
+	Depth    uint           `json:"depth"`
+	Capacity uint           `json:"capacity"`
+
+	// HighWatermark is the deepest the queue has been since startup
+	HighWatermark uint64 `json:"highWatermark"`
+
+	Enqueued uint64 `json:"enqueued"`
+	TimedOut uint64 `json:"timedOut"`
+	Shed     uint64 `json:"shed"`
+	Rejected uint64 `json:"rejected"`
+}
+
+type queueCounters struct {
+	highWatermark atomic.Uint64
+
+	enqueued atomic.Uint64
+	timedOut atomic.Uint64
+	shed     atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// enqueue hands a batch over to the workers according to the overload policy
+func (ingest *Ingest) enqueue(batch packetBatch) error {
+	switch ingest.queueConfig.policy {
+	case OverloadReject:
+		select {
+		case ingest.incomingPackets <- batch:
+		default:
+			ingest.queueCounters.rejected.Add(1)
+			return errBusy
+		}
+	case OverloadShedOldest:
+		for queued := false; !queued; {
+			select {
+			case ingest.incomingPackets <- batch:
+				queued = true
+			default:
+				select {
+				case oldest := <-ingest.incomingPackets:
+					ingest.queueCounters.shed.Add(1)
+					oldest.result <- batchResult{
+						reason: RejectedBusy,
+						err:    errBusy,
+					}
+				default:
+					// a worker took the oldest batch in the meantime
+				}
+			}
+		}
+	default:
+		timer := time.NewTimer(ingest.queueConfig.blockTimeout)
+		defer timer.Stop()
+
+		select {
+		case ingest.incomingPackets <- batch:
+		case <-timer.C:
+			ingest.queueCounters.timedOut.Add(1)
+			return errBusy
+		}
+	}
+
+	ingest.queueCounters.enqueued.Add(1)
+
+	depth := uint64(len(ingest.incomingPackets))
+	for {
+		highWatermark := ingest.queueCounters.highWatermark.Load()
+		if depth <= highWatermark || ingest.queueCounters.highWatermark.CompareAndSwap(highWatermark, depth) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// OverloadPolicy returns the policy that is applied when the processing queue is full
+func (ingest *Ingest) OverloadPolicy() OverloadPolicy {
+	return ingest.queueConfig.policy
+}
+
+func (ingest *Ingest) QueueMetrics() QueueMetrics {
+	return QueueMetrics{
+		Policy:   ingest.queueConfig.policy,
+		Depth:    uint(len(ingest.incomingPackets)),
+		Capacity: uint(cap(ingest.incomingPackets)),
+
+		HighWatermark: ingest.queueCounters.highWatermark.Load(),
+
+		Enqueued: ingest.queueCounters.enqueued.Load(),
+		TimedOut: ingest.queueCounters.timedOut.Load(),
+		Shed:     ingest.queueCounters.shed.Load(),
+		Rejected: ingest.queueCounters.rejected.Load(),
+	}
+}
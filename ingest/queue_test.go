@@ -0,0 +1,78 @@
+package ingest
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestQueue(policy OverloadPolicy) *Ingest {
+	return &Ingest{
+		incomingPackets: make(chan packetBatch, 2),
+		queueConfig: queueConfig{
+			size:         2,
+			policy:       policy,
+			blockTimeout: 10 * time.Millisecond,
+		},
+	}
+}
+
+func newTestBatch() packetBatch {
+	return packetBatch{
+		deviceID: "test",
+		result:   make(chan batchResult, 1),
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	for _, policy := range []OverloadPolicy{OverloadBlock, OverloadReject} {
+		t.Run(string(policy), func(t *testing.T) {
+			ingest := newTestQueue(policy)
+
+			for i := 0; i < 2; i++ {
+				if err := ingest.enqueue(newTestBatch()); err != nil {
+					t.Fatalf("batch %d: %s", i, err)
+				}
+			}
+
+			if err := ingest.enqueue(newTestBatch()); !errors.Is(err, errBusy) {
+				t.Fatalf("expected errBusy, got %v", err)
+			}
+
+			metrics := ingest.QueueMetrics()
+			if metrics.Depth != 2 || metrics.HighWatermark != 2 || metrics.Enqueued != 2 || metrics.TimedOut+metrics.Rejected != 1 {
+				t.Fatalf("unexpected metrics %+v", metrics)
+			}
+		})
+	}
+}
+
+func TestEnqueueShedOldest(t *testing.T) {
+	ingest := newTestQueue(OverloadShedOldest)
+
+	batches := []packetBatch{newTestBatch(), newTestBatch(), newTestBatch()}
+	for i, batch := range batches {
+		if err := ingest.enqueue(batch); err != nil {
+			t.Fatalf("batch %d: %s", i, err)
+		}
+	}
+
+	select {
+	case result := <-batches[0].result:
+		if result.reason != RejectedBusy {
+			t.Fatalf("expected the oldest batch to be shed, got %+v", result)
+		}
+	default:
+		t.Fatalf("the oldest batch was not shed")
+	}
+
+	for _, batch := range batches[1:] {
+		if queued := <-ingest.incomingPackets; queued.result != batch.result {
+			t.Fatalf("unexpected batch in the queue")
+		}
+	}
+
+	if metrics := ingest.QueueMetrics(); metrics.Shed != 1 || metrics.Enqueued != 3 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+}
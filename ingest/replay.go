@@ -0,0 +1,77 @@
+package ingest
+
+// replayWindowSize is the number of sequence ids, counting back from the highest accepted one, that a session
+// remembers. Packets older than that are rejected as they can't be told apart from replays.
+const replayWindowSize = 4096
+
+// replayWindow is a sliding bitmap of the sequence ids that were accepted in a session.
+// The bit of sequence id `n` is bit `n % replayWindowSize` of the bitmap.
+type replayWindow struct {
+	highest uint
+	bits    [replayWindowSize / 64]uint64
+
+	// contiguous is the lowest sequence id that was not seen
+	contiguous uint
+}
+
+func (window *replayWindow) bit(sequenceID uint) (word int, mask uint64) {
+	index := sequenceID % replayWindowSize
+	return int(index / 64), uint64(1) << (index % 64)
+}
+
+// tooOld tells whether a sequence id has fallen out of the window
+func (window *replayWindow) tooOld(sequenceID uint) bool {
+	return sequenceID+replayWindowSize <= window.highest
+}
+
+// seen tells whether a sequence id was accepted before, sequence ids that are too old count as seen
+func (window *replayWindow) seen(sequenceID uint) bool {
+	if sequenceID > window.highest {
+		return false
+	}
+
+	if window.tooOld(sequenceID) {
+		return true
+	}
+
+	word, mask := window.bit(sequenceID)
+	return window.bits[word]&mask != 0
+}
+
+// mark records a sequence id as accepted, sliding the window forward if needed
+func (window *replayWindow) mark(sequenceID uint) {
+	if sequenceID > window.highest {
+		if sequenceID-window.highest >= replayWindowSize {
+			window.bits = [replayWindowSize / 64]uint64{}
+		} else {
+			for n := window.highest + 1; n < sequenceID; n++ {
+				word, mask := window.bit(n)
+				window.bits[word] &^= mask
+			}
+		}
+
+		window.highest = sequenceID
+	}
+
+	word, mask := window.bit(sequenceID)
+	window.bits[word] |= mask
+
+	if window.tooOld(window.contiguous) {
+		window.contiguous = window.highest - replayWindowSize + 1
+	}
+
+	for window.contiguous <= window.highest && window.seen(window.contiguous) {
+		window.contiguous++
+	}
+}
+
+// fill marks every sequence id up to and including `highest` as seen.
+// This is used for resumed sessions whose window was lost, it rejects stragglers instead of accepting replays.
+func (window *replayWindow) fill(highest uint) {
+	window.highest = highest
+	window.contiguous = highest + 1
+
+	for i := range window.bits {
+		window.bits[i] = ^uint64(0)
+	}
+}
@@ -0,0 +1,272 @@
+package ingest
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/xor-shift/teleserver/util/rng"
+	"sync"
+)
+
+// DefaultRNGAlgorithm is the generator used by sessions that don't ask for a specific one
+const DefaultRNGAlgorithm = "xoshiro128pp"
+
+// rngJumpThreshold is the largest gap in sequence ids that is closed by stepping the generator, larger gaps are
+// closed with a jump instead
+const rngJumpThreshold = 1024
+
+type state struct {
+	deviceID         string
+	sessionID        uint
+	rngAlgorithm     string
+	initialRNGVector []uint32
+
+	// rngMutex guards generator and rngPosition, batches of the same session may be verified concurrently
+	rngMutex *sync.Mutex
+	// generator is the session's generator after rngPosition values were drawn from initialRNGVector
+	generator   rng.Generator32
+	rngPosition uint
+
+	// statsMutex guards stats, statsDirty and replayWindow, stats are read by http handlers while packets are being
+	// processed
+	statsMutex   *sync.Mutex
+	stats        SessionStats
+	statsDirty   bool
+	replayWindow replayWindow
+
+	// inFlight is the number of batches of the session that are being processed, it's guarded by
+	// Ingest.sessionsMutex
+	inFlight uint
+}
+
+// SessionStats describes the quality of a session's link as seen through the sequence ids of its packets.
+type SessionStats struct {
+	DeviceID  string `json:"deviceId"`
+	SessionID uint   `json:"sessionId"`
+
+	ReceivedPackets   uint `json:"received"`
+	HighestSequenceID uint `json:"highestSeq"`
+	DroppedPackets    uint `json:"dropped"`
+	DuplicatePackets  uint `json:"duplicate"`
+	OutOfOrderPackets uint `json:"outOfOrder"`
+}
+
+type rngSnapshot struct {
+	state    []uint32
+	position uint
+}
+
+// generateRNGVector returns a random, non-zero initial state for the named generator. The state is what keeps packets
+// from being forged or replayed, so it's drawn from crypto/rand.
+func generateRNGVector(rngAlgorithm string) ([]uint32, error) {
+	generator, err := rng.NewGenerator32(rngAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	vector := generator.State()
+	buffer := make([]uint8, 4*len(vector))
+
+	for {
+		if _, err = rand.Read(buffer); err != nil {
+			return nil, err
+		}
+
+		nonZero := false
+
+		for i := range vector {
+			vector[i] = binary.LittleEndian.Uint32(buffer[4*i:])
+			nonZero = nonZero || vector[i] != 0
+		}
+
+		// an all-zero state would make the generator output nothing but zeroes
+		if nonZero {
+			return vector, nil
+		}
+	}
+}
+
+func newState(deviceID string, sessionID uint, rngAlgorithm string, initialRNGVector []uint32) (*state, error) {
+	generator, err := rng.NewGenerator32(rngAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = generator.SetState(initialRNGVector); err != nil {
+		return nil, err
+	}
+
+	return &state{
+		deviceID:         deviceID,
+		sessionID:        sessionID,
+		rngAlgorithm:     rngAlgorithm,
+		initialRNGVector: initialRNGVector,
+
+		rngMutex:    &sync.Mutex{},
+		generator:   generator,
+		rngPosition: 0,
+
+		statsMutex: &sync.Mutex{},
+	}, nil
+}
+
+func (state *state) snapshot() rngSnapshot {
+	return rngSnapshot{
+		state:    state.generator.State(),
+		position: state.rngPosition,
+	}
+}
+
+func (state *state) restore(snapshot rngSnapshot) {
+	_ = state.generator.SetState(snapshot.state)
+	state.rngPosition = snapshot.position
+}
+
+// verifyRNG tells whether `value` is the value of the session's generator for the given sequence id.
+// The cached generator position is left untouched if it isn't.
+func (state *state) verifyRNG(sequenceID uint, value uint32) (expected uint32, ok bool) {
+	state.rngMutex.Lock()
+	defer state.rngMutex.Unlock()
+
+	snapshot := state.snapshot()
+
+	if expected = state.getNthRNG(sequenceID); expected != value {
+		state.restore(snapshot)
+		return expected, false
+	}
+
+	return expected, true
+}
+
+// getNthRNG returns the n-th (zero-indexed) value of the session's generator.
+// Packets arriving in order cost a single step, gaps and out-of-order packets cost a logarithmic jump.
+func (state *state) getNthRNG(n uint) uint32 {
+	if n < state.rngPosition {
+		// old packets don't move the cached position, newer packets will most likely continue from it
+		generator, _ := rng.NewGenerator32(state.rngAlgorithm)
+		_ = generator.SetState(state.initialRNGVector)
+		generator.Advance(uint64(n))
+		return generator.Next()
+	}
+
+	if gap := n - state.rngPosition; gap > rngJumpThreshold {
+		state.generator.Advance(uint64(gap))
+	} else {
+		for i := uint(0); i < gap; i++ {
+			_ = state.generator.Next()
+		}
+	}
+
+	state.rngPosition = n + 1
+
+	return state.generator.Next()
+}
+
+// isDuplicate tells whether a packet with the given sequence id was already accepted, counting it as a duplicate if so.
+func (state *state) isDuplicate(sequenceID uint) bool {
+	state.statsMutex.Lock()
+	defer state.statsMutex.Unlock()
+
+	if state.stats.ReceivedPackets == 0 || !state.replayWindow.seen(sequenceID) {
+		return false
+	}
+
+	state.stats.DuplicatePackets++
+	state.statsDirty = true
+
+	return true
+}
+
+// countDuplicate counts a duplicate that was caught without isDuplicate, i.e. a packet that is repeated within a batch
+func (state *state) countDuplicate() {
+	state.statsMutex.Lock()
+	defer state.statsMutex.Unlock()
+
+	state.stats.DuplicatePackets++
+	state.statsDirty = true
+}
+
+// highestContiguousSequenceID returns the sequence id up to which every packet was seen, or -1 if there's none
+func (state *state) highestContiguousSequenceID() int64 {
+	state.statsMutex.Lock()
+	defer state.statsMutex.Unlock()
+
+	return int64(state.replayWindow.contiguous) - 1
+}
+
+// recordSequenceID updates the link statistics with the sequence id of a verified packet.
+// It returns false and counts a duplicate if the sequence id was already accepted or is too old to tell.
+func (state *state) recordSequenceID(sequenceID uint) bool {
+	state.statsMutex.Lock()
+	defer state.statsMutex.Unlock()
+
+	stats := &state.stats
+
+	switch {
+	case stats.ReceivedPackets == 0:
+		// everything before the first packet of the session was lost
+		stats.DroppedPackets = sequenceID
+		stats.HighestSequenceID = sequenceID
+	case state.replayWindow.seen(sequenceID):
+		stats.DuplicatePackets++
+		state.statsDirty = true
+		return false
+	case sequenceID > stats.HighestSequenceID:
+		stats.DroppedPackets += sequenceID - stats.HighestSequenceID - 1
+		stats.HighestSequenceID = sequenceID
+	default:
+		// a packet that was counted as dropped arrived late
+		stats.OutOfOrderPackets++
+		if stats.DroppedPackets != 0 {
+			stats.DroppedPackets--
+		}
+	}
+
+	state.replayWindow.mark(sequenceID)
+	stats.ReceivedPackets++
+	state.statsDirty = true
+
+	return true
+}
+
+// resumeStats restores the link statistics of a resumed session.
+func (state *state) resumeStats(stats SessionStats) {
+	state.statsMutex.Lock()
+	defer state.statsMutex.Unlock()
+
+	state.stats = stats
+
+	if stats.ReceivedPackets != 0 {
+		state.replayWindow.fill(stats.HighestSequenceID)
+	}
+}
+
+// takeDirtyStats returns a copy of the session's link statistics if they changed since the last call
+func (state *state) takeDirtyStats() (SessionStats, bool) {
+	state.statsMutex.Lock()
+	defer state.statsMutex.Unlock()
+
+	if !state.statsDirty {
+		return SessionStats{}, false
+	}
+
+	state.statsDirty = false
+
+	return state.copyStats(), true
+}
+
+// getStats returns a copy of the session's link statistics
+func (state *state) getStats() SessionStats {
+	state.statsMutex.Lock()
+	defer state.statsMutex.Unlock()
+
+	return state.copyStats()
+}
+
+// copyStats is getStats for callers that hold statsMutex
+func (state *state) copyStats() SessionStats {
+	stats := state.stats
+	stats.DeviceID = state.deviceID
+	stats.SessionID = state.sessionID
+
+	return stats
+}
@@ -0,0 +1,229 @@
+package ingest
+
+import (
+	"fmt"
+	"github.com/xor-shift/teleserver/util/rng"
+	"math/rand"
+	"testing"
+)
+
+// packets arrive at 10 Hz
+const packetsPerHour = 10 * 60 * 60
+
+var testRNGVector = []uint32{0xEA5469FE, 0x705AC12C, 0x1C2DF95B, 0xBC435DED}
+
+func newTestState(tb testing.TB, rngAlgorithm string) *state {
+	generator, err := rng.NewGenerator32(rngAlgorithm)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	session, err := newState("test", 1, rngAlgorithm, testRNGVector[:len(generator.State())])
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return session
+}
+
+func naiveNthRNG(rngAlgorithm string, initialRNGVector []uint32, n uint) uint32 {
+	generator, _ := rng.NewGenerator32(rngAlgorithm)
+	_ = generator.SetState(initialRNGVector)
+
+	for i := uint(0); i < n; i++ {
+		_ = generator.Next()
+	}
+
+	return generator.Next()
+}
+
+func TestGetNthRNG(t *testing.T) {
+	for _, rngAlgorithm := range rng.Generators32() {
+		t.Run(rngAlgorithm, func(t *testing.T) {
+			testGetNthRNG(t, newTestState(t, rngAlgorithm))
+		})
+	}
+}
+
+func testGetNthRNG(t *testing.T, session *state) {
+	const count = 4096
+
+	expected := make([]uint32, count)
+	generator, _ := rng.NewGenerator32(session.rngAlgorithm)
+	_ = generator.SetState(session.initialRNGVector)
+	for i := range expected {
+		expected[i] = generator.Next()
+	}
+
+	// mostly in order with some gaps, duplicates and stragglers
+	source := rand.New(rand.NewSource(1))
+	for i := 0; i < count; i++ {
+		var n uint
+
+		switch source.Intn(8) {
+		case 0:
+			n = uint(source.Intn(count))
+		case 1:
+			n = session.rngPosition + uint(source.Intn(2*rngJumpThreshold))
+		default:
+			n = session.rngPosition
+		}
+
+		if n >= count {
+			continue
+		}
+
+		if got := session.getNthRNG(n); got != expected[n] {
+			t.Fatalf("Value %d: expected %08X got %08X", n, expected[n], got)
+		}
+	}
+
+	far := uint(24 * packetsPerHour)
+	if got, want := session.getNthRNG(far), naiveNthRNG(session.rngAlgorithm, session.initialRNGVector, far); got != want {
+		t.Fatalf("Value %d: expected %08X got %08X", far, want, got)
+	}
+}
+
+// BenchmarkGetNthRNGInOrder measures the cost of verifying the next in-order packet at different points of a session.
+// The cost per packet should not depend on how long the session has been running.
+func BenchmarkGetNthRNGInOrder(b *testing.B) {
+	for _, hours := range []uint{0, 1, 6, 12, 24} {
+		b.Run(fmt.Sprintf("%dh", hours), func(b *testing.B) {
+			session := newTestState(b, DefaultRNGAlgorithm)
+			_ = session.getNthRNG(hours * packetsPerHour)
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				_ = session.getNthRNG(session.rngPosition)
+			}
+		})
+	}
+}
+
+// BenchmarkGetNthRNGGap measures the cost of verifying a packet after a gap of lost packets.
+func BenchmarkGetNthRNGGap(b *testing.B) {
+	for _, gap := range []uint{10, rngJumpThreshold, 10 * 60, packetsPerHour} {
+		b.Run(fmt.Sprintf("%d", gap), func(b *testing.B) {
+			session := newTestState(b, DefaultRNGAlgorithm)
+
+			for i := 0; i < b.N; i++ {
+				_ = session.getNthRNG(session.rngPosition + gap)
+			}
+		})
+	}
+}
+
+// BenchmarkGetNthRNGOutOfOrder measures the cost of verifying a straggler from anywhere in a 24-hour session.
+func BenchmarkGetNthRNGOutOfOrder(b *testing.B) {
+	session := newTestState(b, DefaultRNGAlgorithm)
+	_ = session.getNthRNG(24 * packetsPerHour)
+
+	source := rand.New(rand.NewSource(1))
+	ns := make([]uint, 1024)
+	for i := range ns {
+		ns[i] = uint(source.Intn(24 * packetsPerHour))
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = session.getNthRNG(ns[i%len(ns)])
+	}
+}
+
+func TestRecordSequenceID(t *testing.T) {
+	session := newTestState(t, DefaultRNGAlgorithm)
+
+	// 2 is lost at first, 4 is duplicated and 2 arrives late
+	sequenceIDs := []uint{1, 3, 4, 4, 7, 2}
+	accepted := []bool{true, true, true, false, true, true}
+
+	for i, sequenceID := range sequenceIDs {
+		if got := session.recordSequenceID(sequenceID); got != accepted[i] {
+			t.Fatalf("sequence id %d: expected accepted=%t got %t", sequenceID, accepted[i], got)
+		}
+	}
+
+	expected := SessionStats{
+		DeviceID:  "test",
+		SessionID: 1,
+
+		ReceivedPackets:   5,
+		HighestSequenceID: 7,
+		DroppedPackets:    3, // 0, 5 and 6
+		DuplicatePackets:  1,
+		OutOfOrderPackets: 1,
+	}
+
+	if got := session.getStats(); got != expected {
+		t.Fatalf("expected %+v got %+v", expected, got)
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	session := newTestState(t, DefaultRNGAlgorithm)
+
+	for n := uint(0); n < 3*replayWindowSize; n += 2 {
+		if !session.recordSequenceID(n) {
+			t.Fatalf("sequence id %d was rejected", n)
+		}
+	}
+
+	highest := session.stats.HighestSequenceID
+
+	for n := uint(0); n <= highest; n++ {
+		expected := n%2 == 1 && n+replayWindowSize > highest
+
+		if got := session.recordSequenceID(n); got != expected {
+			t.Fatalf("sequence id %d: expected accepted=%t got %t", n, expected, got)
+		}
+
+		// replays of accepted packets are always rejected
+		if session.recordSequenceID(n) {
+			t.Fatalf("sequence id %d was accepted twice", n)
+		}
+	}
+
+	// resumed sessions don't know which packets were seen and reject everything in the window
+	resumed := newTestState(t, DefaultRNGAlgorithm)
+	resumed.resumeStats(session.getStats())
+
+	if resumed.recordSequenceID(highest - 1) {
+		t.Fatalf("resumed session accepted sequence id %d", highest-1)
+	}
+
+	if !resumed.recordSequenceID(highest + 1) {
+		t.Fatalf("resumed session rejected sequence id %d", highest+1)
+	}
+}
+
+func TestHighestContiguousSequenceID(t *testing.T) {
+	session := newTestState(t, DefaultRNGAlgorithm)
+
+	if got := session.highestContiguousSequenceID(); got != -1 {
+		t.Fatalf("expected -1 got %d", got)
+	}
+
+	steps := []struct {
+		sequenceID uint
+		expected   int64
+	}{
+		{1, -1},
+		{0, 1},
+		{3, 1},
+		{2, 3},
+		// packets that fall out of the replay window can't be accepted anymore
+		{10 + replayWindowSize, 10},
+		{11 + replayWindowSize, 11},
+		{12, 12},
+	}
+
+	for _, step := range steps {
+		session.recordSequenceID(step.sequenceID)
+
+		if got := session.highestContiguousSequenceID(); got != step.expected {
+			t.Fatalf("after sequence id %d: expected %d got %d", step.sequenceID, step.expected, got)
+		}
+	}
+}
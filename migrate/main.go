@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"github.com/alecthomas/kong"
+	"github.com/joho/godotenv"
+	"github.com/xor-shift/teleserver/migrations"
+	"github.com/xor-shift/teleserver/storage"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+type Args struct {
+	Up struct {
+		To uint `name:"to" default:"0" help:"Version to migrate up to, 0 for the latest"`
+	} `cmd:"" help:"Apply the migrations that weren't applied yet"`
+
+	Down struct {
+		To    int  `name:"to" default:"-1" help:"Version to migrate down to, 0 to revert everything, overrides --steps unless it's -1"`
+		Steps uint `name:"steps" default:"1" help:"Number of migrations to revert"`
+	} `cmd:"" help:"Revert the latest migrations"`
+
+	Status struct{} `cmd:"" help:"Show the applied and pending migrations"`
+
+	Force struct {
+		Version uint `arg:"" help:"Version the schema is at"`
+	} `cmd:"" help:"Record the schema as being at a version without running any migration, e.g. after fixing a dirty schema by hand"`
+
+	Hypertable struct {
+		ChunkInterval time.Duration `name:"chunk-interval" default:"168h" help:"Time range of the chunks of the hypertable"`
+		CompressAfter time.Duration `name:"compress-after" default:"168h" help:"Age after which chunks are compressed, 0 to not compress them"`
+	} `cmd:"" help:"Turn the packets table into a TimescaleDB hypertable (PostgreSQL only), consumer_db then needs the keep_first conflict policy"`
+}
+
+func init() {
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatalf("loading dotenv failed: %s", err)
+	}
+}
+
+func status(db *storage.DB, migrator *migrations.Migrator) {
+	all, err := migrations.All(db.Name())
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	applied, err := migrator.Applied()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	appliedByVersion := map[uint]migrations.AppliedMigration{}
+	for _, migration := range applied {
+		appliedByVersion[migration.Version] = migration
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "Version\tName\tState\tApplied at")
+
+	for _, migration := range all {
+		state, appliedAt := "pending", ""
+
+		if applied, ok := appliedByVersion[migration.Version]; ok {
+			state, appliedAt = "applied", applied.AppliedAt.Format("2006-01-02 15:04:05")
+
+			if applied.Dirty {
+				state = "dirty"
+			}
+		}
+
+		_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\t%s\n", migration.Version, migration.Name, state, appliedAt)
+	}
+
+	_ = writer.Flush()
+}
+
+func main() {
+	args := Args{}
+
+	ctx := kong.Parse(&args)
+
+	db, err := storage.Open()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	current, _, err := migrator.Current()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch ctx.Command() {
+	case "up":
+		target := args.Up.To
+		if target == 0 {
+			target = migrations.Latest()
+		}
+
+		err = migrator.Up(target)
+	case "down":
+		var target uint
+		switch {
+		case args.Down.To >= 0:
+			target = uint(args.Down.To)
+		case args.Down.Steps < current:
+			target = current - args.Down.Steps
+		}
+
+		err = migrator.Down(target)
+	case "status":
+		status(db, migrator)
+	case "force <version>":
+		err = migrator.Force(args.Force.Version)
+	case "hypertable":
+		err = migrator.CreateHypertable(args.Hypertable.ChunkInterval, args.Hypertable.CompressAfter)
+	}
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if current, dirty, err := migrator.Current(); err == nil {
+		log.Printf("the schema is at version %d (latest: %d, dirty: %t)", current, migrations.Latest(), dirty)
+	}
+}
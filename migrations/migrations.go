@@ -0,0 +1,398 @@
+// Package migrations holds the numbered schema migrations of the database and applies them.
+//
+// Every migration is a pair of files in sql/<driver>/, <version>_<name>.up.sql and <version>_<name>.down.sql. Every
+// database driver has its own files and the same versions, a version means the same schema whatever the database. The
+// versions that were applied are recorded in the schema_migrations table. On PostgreSQL every migration runs in a
+// transaction along with the update of its version. MySQL commits DDL statements implicitly, so a migration that fails
+// halfway there leaves its version marked as dirty until the schema is fixed by hand and the version is forced.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/xor-shift/teleserver/storage"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*/*.sql
+var files embed.FS
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// createTableQueries are the queries that create schema_migrations, by driver
+var createTableQueries = map[string]string{
+	storage.DriverMySQL: "" +
+		"CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"version int(11) unsigned NOT NULL, " +
+		"name varchar(255) NOT NULL DEFAULT '', " +
+		"dirty tinyint(1) NOT NULL DEFAULT 0, " +
+		"applied_at timestamp NOT NULL DEFAULT current_timestamp(), " +
+		"PRIMARY KEY (version)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci",
+	storage.DriverPostgres: "" +
+		"CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"version bigint NOT NULL, " +
+		"name varchar(255) NOT NULL DEFAULT '', " +
+		"dirty boolean NOT NULL DEFAULT false, " +
+		"applied_at timestamptz NOT NULL DEFAULT current_timestamp, " +
+		"PRIMARY KEY (version)" +
+		")",
+}
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// AppliedMigration is a row of schema_migrations
+type AppliedMigration struct {
+	Version   uint
+	Name      string
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+// All returns the embedded migrations of a driver ordered by their versions
+func All(driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql/"+driver)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("no migrations for the driver \"%s\"", driver))
+	}
+
+	byVersion := map[uint]*Migration{}
+
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, errors.New(fmt.Sprintf("bad migration file name \"%s\"", entry.Name()))
+		}
+
+		version, _ := strconv.ParseUint(match[1], 10, 32)
+
+		contents, err := fs.ReadFile(files, "sql/"+driver+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = migration
+		} else if migration.Name != match[2] {
+			return nil, errors.New(fmt.Sprintf("migration %d is named both \"%s\" and \"%s\"", version, migration.Name, match[2]))
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, migration := range migrations {
+		if migration.Version != uint(i+1) {
+			return nil, errors.New(fmt.Sprintf("migration %d is missing", i+1))
+		}
+
+		if migration.Up == "" || migration.Down == "" {
+			return nil, errors.New(fmt.Sprintf("migration %d needs both an up and a down file", migration.Version))
+		}
+	}
+
+	return migrations, nil
+}
+
+// Latest returns the version of the last embedded migration, which is the schema version this build expects. It's the
+// same for every driver.
+func Latest() uint {
+	migrations, err := All(storage.DriverMySQL)
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+
+	return migrations[len(migrations)-1].Version
+}
+
+// splitStatements splits the contents of a migration file into statements, dropping comment lines
+func splitStatements(contents string) []string {
+	var lines []string
+	for _, line := range strings.Split(contents, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	var statements []string
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";\n") {
+		if statement = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(statement), ";")); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	return statements
+}
+
+// Migrator applies the embedded migrations to a database
+type Migrator struct {
+	db         *storage.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *storage.DB) (*Migrator, error) {
+	migrations, err := All(db.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = db.Exec(createTableQueries[db.Name()]); err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Applied returns the migrations that were applied, in order
+func (migrator *Migrator) Applied() ([]AppliedMigration, error) {
+	return appliedMigrations(migrator.db)
+}
+
+func appliedMigrations(db *storage.DB) ([]AppliedMigration, error) {
+	rows, err := db.Query("SELECT version, name, dirty, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var applied []AppliedMigration
+
+	for rows.Next() {
+		var migration AppliedMigration
+		if err = rows.Scan(&migration.Version, &migration.Name, &migration.Dirty, &migration.AppliedAt); err != nil {
+			return nil, err
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, rows.Err()
+}
+
+// currentVersion returns the highest applied version and whether any applied migration is dirty
+func currentVersion(db *storage.DB) (uint, bool, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var version uint
+	dirty := false
+
+	for _, migration := range applied {
+		version = migration.Version
+		dirty = dirty || migration.Dirty
+	}
+
+	return version, dirty, nil
+}
+
+// Current returns the schema version of the database and whether it's dirty
+func (migrator *Migrator) Current() (uint, bool, error) {
+	return currentVersion(migrator.db)
+}
+
+// execer is what the statements of a migration run on, the database or a transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func run(db execer, migration Migration, contents string) error {
+	for _, statement := range splitStatements(contents) {
+		if _, err := db.Exec(statement); err != nil {
+			return errors.New(fmt.Sprintf("migration %d (%s) failed: %s", migration.Version, migration.Name, err))
+		}
+	}
+
+	return nil
+}
+
+// apply applies or reverts a migration and records it in schema_migrations
+func (migrator *Migrator) apply(migration Migration, up bool) error {
+	contents := migration.Down
+	record := migrator.db.Rebind("DELETE FROM schema_migrations WHERE version = ?")
+	recordArgs := []any{migration.Version}
+
+	if up {
+		contents = migration.Up
+		record = migrator.db.Rebind("INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, ?)")
+		recordArgs = []any{migration.Version, migration.Name, false}
+	}
+
+	// PostgreSQL runs DDL in transactions, a migration that fails is rolled back as a whole along with its version
+	if migrator.db.Name() == storage.DriverPostgres {
+		tx, err := migrator.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err = run(tx, migration, contents); err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(record, recordArgs...); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+
+	// MySQL commits every DDL statement on its own, the version is marked as dirty until the migration is through
+	var err error
+	if up {
+		_, err = migrator.db.Exec(record, migration.Version, migration.Name, true)
+	} else {
+		_, err = migrator.db.Exec(migrator.db.Rebind("UPDATE schema_migrations SET dirty = ? WHERE version = ?"), true, migration.Version)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = run(migrator.db, migration, contents); err != nil {
+		return errors.New(fmt.Sprintf("%s, fix the schema by hand and force the version", err))
+	}
+
+	if up {
+		_, err = migrator.db.Exec(migrator.db.Rebind("UPDATE schema_migrations SET dirty = ? WHERE version = ?"), false, migration.Version)
+	} else {
+		_, err = migrator.db.Exec(record, recordArgs...)
+	}
+
+	return err
+}
+
+// Up applies the migrations up to and including `target`
+func (migrator *Migrator) Up(target uint) error {
+	current, dirty, err := migrator.Current()
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return errors.New("the schema is dirty, fix it and force the version first")
+	}
+
+	for _, migration := range migrator.migrations {
+		if migration.Version <= current || migration.Version > target {
+			continue
+		}
+
+		log.Printf("applying migration %d (%s)", migration.Version, migration.Name)
+
+		if err = migrator.apply(migration, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Down reverts the migrations above `target`, latest first
+func (migrator *Migrator) Down(target uint) error {
+	current, dirty, err := migrator.Current()
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return errors.New("the schema is dirty, fix it and force the version first")
+	}
+
+	for i := len(migrator.migrations) - 1; i >= 0; i-- {
+		migration := migrator.migrations[i]
+		if migration.Version > current || migration.Version <= target {
+			continue
+		}
+
+		log.Printf("reverting migration %d (%s)", migration.Version, migration.Name)
+
+		if err = migrator.apply(migration, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Force records the schema as being at `version` without running anything, for databases whose schema was fixed or
+// created by hand
+func (migrator *Migrator) Force(version uint) error {
+	if version > uint(len(migrator.migrations)) {
+		return errors.New(fmt.Sprintf("there is no migration %d", version))
+	}
+
+	tx, err := migrator.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(migrator.db.Rebind("DELETE FROM schema_migrations WHERE version > ?"), version); err != nil {
+		return err
+	}
+
+	query := migrator.db.Rebind("INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, ?) " +
+		migrator.db.Upsert("schema_migrations", []string{"version"}, []string{"dirty"}))
+
+	for _, migration := range migrator.migrations[:version] {
+		if _, err = tx.Exec(query, migration.Version, migration.Name, false); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Check makes sure that the schema of the database is the one this build expects, services call it on startup.
+// A newer schema is accepted with a warning so that services that weren't redeployed yet keep running after a
+// migration, which is why migrations should keep the existing columns working.
+func Check(db *storage.DB) error {
+	current, dirty, err := currentVersion(db)
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to read the schema version, was `migrate up` run? %s", err))
+	}
+
+	latest := Latest()
+
+	switch {
+	case dirty:
+		return errors.New(fmt.Sprintf("the schema is dirty at version %d", current))
+	case current < latest:
+		return errors.New(fmt.Sprintf("the schema is at version %d but %d is needed, run `migrate up`", current, latest))
+	case current > latest:
+		log.Printf("the schema is at version %d, newer than %d", current, latest)
+	}
+
+	return nil
+}
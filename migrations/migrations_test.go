@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"github.com/xor-shift/teleserver/storage"
+	"strings"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	for _, driver := range []string{storage.DriverMySQL, storage.DriverPostgres} {
+		migrations, err := All(driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if Latest() != uint(len(migrations)) {
+			t.Fatalf("%s: expected the latest version to be %d got %d", driver, len(migrations), Latest())
+		}
+
+		for _, migration := range migrations {
+			for _, contents := range []string{migration.Up, migration.Down} {
+				statements := splitStatements(contents)
+				if len(statements) == 0 {
+					t.Fatalf("%s: migration %d has an empty file", driver, migration.Version)
+				}
+
+				for _, statement := range statements {
+					if strings.Contains(statement, ";") || strings.HasPrefix(statement, "--") {
+						t.Fatalf("%s: migration %d was split badly: %q", driver, migration.Version, statement)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDriversAgree(t *testing.T) {
+	mysqlMigrations, _ := All(storage.DriverMySQL)
+	postgresMigrations, _ := All(storage.DriverPostgres)
+
+	if len(mysqlMigrations) != len(postgresMigrations) {
+		t.Fatalf("%d MySQL migrations but %d PostgreSQL ones", len(mysqlMigrations), len(postgresMigrations))
+	}
+
+	for i := range mysqlMigrations {
+		if mysqlMigrations[i].Name != postgresMigrations[i].Name {
+			t.Fatalf("migration %d is \"%s\" for MySQL but \"%s\" for PostgreSQL", i+1, mysqlMigrations[i].Name, postgresMigrations[i].Name)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	contents := "-- a comment\nCREATE TABLE a (\n  b int\n);\n\nDROP TABLE c;\n"
+
+	statements := splitStatements(contents)
+	expected := []string{"CREATE TABLE a (\n  b int\n)", "DROP TABLE c"}
+
+	if len(statements) != len(expected) {
+		t.Fatalf("expected %q got %q", expected, statements)
+	}
+
+	for i := range expected {
+		if statements[i] != expected[i] {
+			t.Fatalf("expected %q got %q", expected[i], statements[i])
+		}
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE packets_json;
+DROP TABLE essential_packets;
+DROP TABLE packets;
+DROP TABLE sessions;
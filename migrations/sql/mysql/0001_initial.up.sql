@@ -1,4 +1,6 @@
-CREATE TABLE sessions (
+-- the schema that _run/common/schema.sql used to create, databases that were created from it are adopted as they are
+
+CREATE TABLE IF NOT EXISTS sessions (
   session_id int(11)     NOT NULL AUTO_INCREMENT,
   prng       varchar(32) NOT NULL DEFAULT '',
   challenge  varchar(64) NOT NULL DEFAULT '',
@@ -8,8 +10,7 @@ CREATE TABLE sessions (
   PRIMARY KEY (session_id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 
-
-CREATE TABLE packets (
+CREATE TABLE IF NOT EXISTS packets (
   session_id                int(11)          NOT NULL DEFAULT 0,
   packet_order              int(11)          NOT NULL DEFAULT 0,
   insert_time               timestamp        NOT NULL DEFAULT current_timestamp(),
@@ -52,7 +53,7 @@ CREATE TABLE packets (
   PRIMARY KEY (session_id, packet_order)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 
-CREATE TABLE essential_packets (
+CREATE TABLE IF NOT EXISTS essential_packets (
   session_id    int(11)   NOT NULL DEFAULT 0,
   packet_order  int(11)   NOT NULL DEFAULT 0,
   insert_time   timestamp NOT NULL DEFAULT current_timestamp(),
@@ -65,12 +66,12 @@ CREATE TABLE essential_packets (
   PRIMARY KEY (session_id, packet_order)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 
-CREATE TABLE packets_json (
+CREATE TABLE IF NOT EXISTS packets_json (
   session_id    int(11)   NOT NULL DEFAULT 0,
   packet_order  int(11)   NOT NULL DEFAULT 0,
   insert_time   timestamp NOT NULL DEFAULT current_timestamp(),
   reported_time timestamp NOT NULL DEFAULT '0000-00-00 00:00:00',
-  inner_data    longtext  NOT NULL DEFAULT '{}'
+  inner_data    longtext  NOT NULL DEFAULT '{}',
 
   PRIMARY KEY (session_id, packet_order)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
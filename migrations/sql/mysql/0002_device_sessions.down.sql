@@ -0,0 +1,5 @@
+ALTER TABLE sessions
+  DROP KEY device_id,
+  DROP COLUMN closed,
+  DROP COLUMN prng_algorithm,
+  DROP COLUMN device_id;
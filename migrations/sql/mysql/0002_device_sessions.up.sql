@@ -0,0 +1,11 @@
+ALTER TABLE sessions
+  ADD COLUMN device_id      varchar(64) NOT NULL DEFAULT ''             AFTER session_id,
+  ADD COLUMN prng_algorithm varchar(32) NOT NULL DEFAULT 'xoshiro128pp' AFTER prng,
+  ADD COLUMN closed         tinyint(1)  NOT NULL DEFAULT 0              AFTER csig_s,
+  ADD KEY (device_id, closed);
+
+-- the sessions from before devices had ids are attributed to the default device, only the latest of them stays open
+UPDATE sessions SET device_id = 'default';
+
+UPDATE sessions SET closed = 1
+  WHERE session_id < (SELECT latest FROM (SELECT MAX(session_id) AS latest FROM sessions) AS latest_session);
@@ -0,0 +1,5 @@
+ALTER TABLE essential_packets
+  DROP COLUMN battery_temperatures,
+  DROP COLUMN remaining_wh,
+  ADD COLUMN bat_temp    float NOT NULL DEFAULT 0 AFTER speed,
+  ADD COLUMN rem_percent float NOT NULL DEFAULT 0 AFTER voltage;
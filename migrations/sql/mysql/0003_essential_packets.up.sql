@@ -0,0 +1,6 @@
+-- the old columns never held data, essentials packets weren't stored before
+ALTER TABLE essential_packets
+  DROP COLUMN bat_temp,
+  DROP COLUMN rem_percent,
+  ADD COLUMN battery_temperatures text  NOT NULL DEFAULT '[]' AFTER speed,
+  ADD COLUMN remaining_wh         float NOT NULL DEFAULT 0    AFTER voltage;
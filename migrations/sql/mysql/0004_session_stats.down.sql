@@ -0,0 +1,6 @@
+ALTER TABLE sessions
+  DROP COLUMN out_of_order_packets,
+  DROP COLUMN duplicate_packets,
+  DROP COLUMN dropped_packets,
+  DROP COLUMN highest_sequence_id,
+  DROP COLUMN received_packets;
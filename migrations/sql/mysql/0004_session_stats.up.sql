@@ -0,0 +1,6 @@
+ALTER TABLE sessions
+  ADD COLUMN received_packets     int(11) unsigned NOT NULL DEFAULT 0 AFTER closed,
+  ADD COLUMN highest_sequence_id  int(11) unsigned NOT NULL DEFAULT 0 AFTER received_packets,
+  ADD COLUMN dropped_packets      int(11) unsigned NOT NULL DEFAULT 0 AFTER highest_sequence_id,
+  ADD COLUMN duplicate_packets    int(11) unsigned NOT NULL DEFAULT 0 AFTER dropped_packets,
+  ADD COLUMN out_of_order_packets int(11) unsigned NOT NULL DEFAULT 0 AFTER duplicate_packets;
@@ -0,0 +1,20 @@
+ALTER TABLE packets
+  ADD COLUMN payload_hash char(64) NOT NULL DEFAULT '' AFTER cpu_usage;
+
+ALTER TABLE essential_packets
+  ADD COLUMN payload_hash char(64) NOT NULL DEFAULT '' AFTER remaining_wh;
+
+CREATE TABLE packet_conflicts (
+  conflict_id         int(11)     NOT NULL AUTO_INCREMENT,
+  detected_at         timestamp   NOT NULL DEFAULT current_timestamp(),
+  table_name          varchar(64) NOT NULL DEFAULT '',
+  session_id          int(11)     NOT NULL DEFAULT 0,
+  packet_order        int(11)     NOT NULL DEFAULT 0,
+  existing_hash       char(64)    NOT NULL DEFAULT '',
+  conflicting_hash    char(64)    NOT NULL DEFAULT '',
+  conflicting_payload longtext    NOT NULL DEFAULT '{}',
+  resolution          varchar(16) NOT NULL DEFAULT '',
+
+  PRIMARY KEY (conflict_id),
+  KEY (session_id, packet_order)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
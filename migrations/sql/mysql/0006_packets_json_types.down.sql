@@ -0,0 +1,4 @@
+ALTER TABLE packets_json
+  DROP KEY session_id,
+  DROP COLUMN payload_hash,
+  DROP COLUMN packet_type;
@@ -0,0 +1,5 @@
+-- packets_json keeps the packets of any type as JSON, see CONSUMER_DB_JSON_STORAGE
+ALTER TABLE packets_json
+  ADD COLUMN packet_type  varchar(32) NOT NULL DEFAULT '' AFTER packet_order,
+  ADD COLUMN payload_hash char(64)    NOT NULL DEFAULT '' AFTER inner_data,
+  ADD KEY (session_id, packet_type);
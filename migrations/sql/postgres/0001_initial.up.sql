@@ -0,0 +1,77 @@
+-- the PostgreSQL counterpart of the MySQL schema at the same version, timestamps are stored with their time zone
+
+CREATE TABLE sessions (
+  session_id bigint      GENERATED BY DEFAULT AS IDENTITY,
+  prng       varchar(32) NOT NULL DEFAULT '',
+  challenge  varchar(64) NOT NULL DEFAULT '',
+  csig_r     varchar(64) NOT NULL DEFAULT '',
+  csig_s     varchar(64) NOT NULL DEFAULT '',
+
+  PRIMARY KEY (session_id)
+);
+
+CREATE TABLE packets (
+  session_id                bigint      NOT NULL DEFAULT 0,
+  packet_order              bigint      NOT NULL DEFAULT 0,
+  insert_time               timestamptz NOT NULL DEFAULT current_timestamp,
+  reported_time             timestamptz NOT NULL DEFAULT 'epoch',
+  battery_voltages          text        NOT NULL DEFAULT '[]',
+  battery_temperatures      text        NOT NULL DEFAULT '[]',
+  spent_mah                 real        NOT NULL DEFAULT 0,
+  spent_mwh                 real        NOT NULL DEFAULT 0,
+  curr                      real        NOT NULL DEFAULT 0,
+  percent_soc               real        NOT NULL DEFAULT 0,
+  hydro_curr                real        NOT NULL DEFAULT 0,
+  hydro_ppm                 real        NOT NULL DEFAULT 0,
+  hydro_temp                real        NOT NULL DEFAULT 0,
+  temperature_smps          real        NOT NULL DEFAULT 0,
+  temperature_engine_driver real        NOT NULL DEFAULT 0,
+  voltage_engine_driver     real        NOT NULL DEFAULT 0,
+  current_engine_driver     real        NOT NULL DEFAULT 0,
+  voltage_telemetry         real        NOT NULL DEFAULT 0,
+  current_telemetry         real        NOT NULL DEFAULT 0,
+  voltage_smps              real        NOT NULL DEFAULT 0,
+  current_smps              real        NOT NULL DEFAULT 0,
+  voltage_bms               real        NOT NULL DEFAULT 0,
+  current_bms               real        NOT NULL DEFAULT 0,
+  speed                     real        NOT NULL DEFAULT 0,
+  rpm                       real        NOT NULL DEFAULT 0,
+  voltage_engine            real        NOT NULL DEFAULT 0,
+  current_engine            real        NOT NULL DEFAULT 0,
+  latitude                  real        NOT NULL DEFAULT 0,
+  longitude                 real        NOT NULL DEFAULT 0,
+  gyro_x                    real        NOT NULL DEFAULT 0,
+  gyro_y                    real        NOT NULL DEFAULT 0,
+  gyro_z                    real        NOT NULL DEFAULT 0,
+  queue_fill_amt            bigint      NOT NULL DEFAULT 0,
+  tick_counter              bigint      NOT NULL DEFAULT 0,
+  free_heap                 bigint      NOT NULL DEFAULT 0,
+  alloc_count               bigint      NOT NULL DEFAULT 0,
+  free_count                bigint      NOT NULL DEFAULT 0,
+  cpu_usage                 real        NOT NULL DEFAULT 0,
+
+  CONSTRAINT packets_pkey PRIMARY KEY (session_id, packet_order)
+);
+
+CREATE TABLE essential_packets (
+  session_id    bigint      NOT NULL DEFAULT 0,
+  packet_order  bigint      NOT NULL DEFAULT 0,
+  insert_time   timestamptz NOT NULL DEFAULT current_timestamp,
+  reported_time timestamptz NOT NULL DEFAULT 'epoch',
+  speed         real        NOT NULL DEFAULT 0,
+  bat_temp      real        NOT NULL DEFAULT 0,
+  voltage       real        NOT NULL DEFAULT 0,
+  rem_percent   real        NOT NULL DEFAULT 0,
+
+  CONSTRAINT essential_packets_pkey PRIMARY KEY (session_id, packet_order)
+);
+
+CREATE TABLE packets_json (
+  session_id    bigint      NOT NULL DEFAULT 0,
+  packet_order  bigint      NOT NULL DEFAULT 0,
+  insert_time   timestamptz NOT NULL DEFAULT current_timestamp,
+  reported_time timestamptz NOT NULL DEFAULT 'epoch',
+  inner_data    text        NOT NULL DEFAULT '{}',
+
+  CONSTRAINT packets_json_pkey PRIMARY KEY (session_id, packet_order)
+);
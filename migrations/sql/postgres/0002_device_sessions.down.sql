@@ -0,0 +1,6 @@
+DROP INDEX sessions_device_id;
+
+ALTER TABLE sessions
+  DROP COLUMN closed,
+  DROP COLUMN prng_algorithm,
+  DROP COLUMN device_id;
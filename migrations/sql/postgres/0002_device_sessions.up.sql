@@ -0,0 +1,12 @@
+-- closed is a smallint rather than a boolean so that the queries are the same as with MySQL
+ALTER TABLE sessions
+  ADD COLUMN device_id      varchar(64) NOT NULL DEFAULT '',
+  ADD COLUMN prng_algorithm varchar(32) NOT NULL DEFAULT 'xoshiro128pp',
+  ADD COLUMN closed         smallint    NOT NULL DEFAULT 0;
+
+CREATE INDEX sessions_device_id ON sessions (device_id, closed);
+
+-- the sessions from before devices had ids are attributed to the default device, only the latest of them stays open
+UPDATE sessions SET device_id = 'default';
+
+UPDATE sessions SET closed = 1 WHERE session_id < (SELECT MAX(session_id) FROM sessions);
@@ -0,0 +1,5 @@
+ALTER TABLE essential_packets
+  DROP COLUMN battery_temperatures,
+  DROP COLUMN remaining_wh,
+  ADD COLUMN bat_temp    real NOT NULL DEFAULT 0,
+  ADD COLUMN rem_percent real NOT NULL DEFAULT 0;
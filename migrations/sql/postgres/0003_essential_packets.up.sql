@@ -0,0 +1,6 @@
+-- the old columns never held data, essentials packets weren't stored before
+ALTER TABLE essential_packets
+  DROP COLUMN bat_temp,
+  DROP COLUMN rem_percent,
+  ADD COLUMN battery_temperatures text NOT NULL DEFAULT '[]',
+  ADD COLUMN remaining_wh         real NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+ALTER TABLE sessions
+  ADD COLUMN received_packets     bigint NOT NULL DEFAULT 0,
+  ADD COLUMN highest_sequence_id  bigint NOT NULL DEFAULT 0,
+  ADD COLUMN dropped_packets      bigint NOT NULL DEFAULT 0,
+  ADD COLUMN duplicate_packets    bigint NOT NULL DEFAULT 0,
+  ADD COLUMN out_of_order_packets bigint NOT NULL DEFAULT 0;
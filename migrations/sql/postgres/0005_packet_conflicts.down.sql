@@ -0,0 +1,7 @@
+DROP TABLE packet_conflicts;
+
+ALTER TABLE essential_packets
+  DROP COLUMN payload_hash;
+
+ALTER TABLE packets
+  DROP COLUMN payload_hash;
@@ -0,0 +1,21 @@
+ALTER TABLE packets
+  ADD COLUMN payload_hash char(64) NOT NULL DEFAULT '';
+
+ALTER TABLE essential_packets
+  ADD COLUMN payload_hash char(64) NOT NULL DEFAULT '';
+
+CREATE TABLE packet_conflicts (
+  conflict_id         bigint      GENERATED BY DEFAULT AS IDENTITY,
+  detected_at         timestamptz NOT NULL DEFAULT current_timestamp,
+  table_name          varchar(64) NOT NULL DEFAULT '',
+  session_id          bigint      NOT NULL DEFAULT 0,
+  packet_order        bigint      NOT NULL DEFAULT 0,
+  existing_hash       char(64)    NOT NULL DEFAULT '',
+  conflicting_hash    char(64)    NOT NULL DEFAULT '',
+  conflicting_payload text        NOT NULL DEFAULT '{}',
+  resolution          varchar(16) NOT NULL DEFAULT '',
+
+  PRIMARY KEY (conflict_id)
+);
+
+CREATE INDEX packet_conflicts_session_id ON packet_conflicts (session_id, packet_order);
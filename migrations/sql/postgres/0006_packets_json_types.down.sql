@@ -0,0 +1,5 @@
+DROP INDEX packets_json_packet_type;
+
+ALTER TABLE packets_json
+  DROP COLUMN payload_hash,
+  DROP COLUMN packet_type;
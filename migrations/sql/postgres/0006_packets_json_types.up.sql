@@ -0,0 +1,6 @@
+-- packets_json keeps the packets of any type as JSON, see CONSUMER_DB_JSON_STORAGE
+ALTER TABLE packets_json
+  ADD COLUMN packet_type  varchar(32) NOT NULL DEFAULT '',
+  ADD COLUMN payload_hash char(64)    NOT NULL DEFAULT '';
+
+CREATE INDEX packets_json_packet_type ON packets_json (session_id, packet_type);
@@ -0,0 +1,102 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xor-shift/teleserver/storage"
+	"log"
+	"time"
+)
+
+type hypertableStatement struct {
+	query string
+	args  []any
+}
+
+// hypertableQuery tells whether a table is a hypertable
+const hypertableQuery = "SELECT count(*) FROM timescaledb_information.hypertables WHERE hypertable_name = ?"
+
+// IsHypertable tells whether a table is a TimescaleDB hypertable, which it can only be on PostgreSQL with the extension
+func IsHypertable(db *storage.DB, table string) (bool, error) {
+	if db.Name() != storage.DriverPostgres {
+		return false, nil
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM pg_extension WHERE extname = 'timescaledb'").Scan(&count); err != nil || count == 0 {
+		return false, err
+	}
+
+	if err := db.QueryRow(db.Rebind(hypertableQuery), table).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count != 0, nil
+}
+
+// CreateHypertable turns the packets table of a PostgreSQL database into a TimescaleDB hypertable partitioned by
+// reported_time, in chunks of `chunkInterval`. If `compressAfter` isn't 0, the chunks that are older than it are
+// compressed. Continuous aggregates can be created on the hypertable afterwards.
+//
+// It isn't a migration since it's optional and only possible with TimescaleDB, the schema version stays the same.
+// Hypertables need the time column in their primary key and in every unique index, so the key becomes (session_id,
+// packet_order, reported_time) and nothing in the database keeps packets with the same sequence id but different
+// reported times apart anymore. Only consumer_db's "keep_first" conflict policy, which looks the sequence ids up
+// before inserting, stays idempotent. consumer_db refuses to start with the other policies once packets is a
+// hypertable.
+func (migrator *Migrator) CreateHypertable(chunkInterval time.Duration, compressAfter time.Duration) error {
+	if migrator.db.Name() != storage.DriverPostgres {
+		return errors.New(fmt.Sprintf("hypertables need TimescaleDB, not %s", migrator.db.Name()))
+	}
+
+	if _, err := migrator.db.Exec("CREATE EXTENSION IF NOT EXISTS timescaledb"); err != nil {
+		return err
+	}
+
+	if hypertable, err := IsHypertable(migrator.db, "packets"); err != nil {
+		return err
+	} else if hypertable {
+		return errors.New("packets is a hypertable already")
+	}
+
+	tx, err := migrator.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []hypertableStatement{
+		{"ALTER TABLE packets DROP CONSTRAINT packets_pkey", nil},
+		{"ALTER TABLE packets ADD CONSTRAINT packets_pkey PRIMARY KEY (session_id, packet_order, reported_time)", nil},
+		{
+			"SELECT create_hypertable('packets', 'reported_time', chunk_time_interval => CAST(? AS interval), migrate_data => true)",
+			[]any{postgresInterval(chunkInterval)},
+		},
+	}
+
+	if compressAfter != 0 {
+		statements = append(statements, []hypertableStatement{
+			{"ALTER TABLE packets SET (timescaledb.compress, timescaledb.compress_segmentby = 'session_id', timescaledb.compress_orderby = 'packet_order')", nil},
+			{"SELECT add_compression_policy('packets', CAST(? AS interval))", []any{postgresInterval(compressAfter)}},
+		}...)
+	}
+
+	for _, statement := range statements {
+		if _, err = tx.Exec(migrator.db.Rebind(statement.query), statement.args...); err != nil {
+			return errors.New(fmt.Sprintf("failed to create the hypertable: %s", err))
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("packets is a hypertable with chunks of %s, compressed after %s", chunkInterval, compressAfter)
+
+	return nil
+}
+
+// postgresInterval formats a duration as an interval literal
+func postgresInterval(duration time.Duration) string {
+	return fmt.Sprintf("%d milliseconds", duration.Milliseconds())
+}
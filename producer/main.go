@@ -3,14 +3,19 @@ package main
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/kataras/iris/v12"
 	"github.com/xor-shift/teleserver/common"
 	"github.com/xor-shift/teleserver/ingest"
+	"github.com/xor-shift/teleserver/util"
 	"log"
 	"math/big"
+	"net/http"
 	"os"
+	"runtime"
 )
 
 var (
@@ -44,24 +49,113 @@ func init() {
 	app = iris.New()
 }
 
+func writeJSON(ctx iris.Context, v any) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		ctx.StatusCode(http.StatusInternalServerError)
+		_, _ = ctx.Text("internal error: %s", err)
+		return
+	}
+
+	ctx.ContentType("application/json")
+	_, _ = ctx.Text(string(jsonData))
+}
+
+func writeAck(ctx iris.Context, asJSON bool, ack ingest.Ack) {
+	if asJSON {
+		writeJSON(ctx, ack)
+		return
+	}
+
+	response := fmt.Sprintf("+CST_ACK %d %d %d", ack.Accepted, ack.Rejected, ack.HighestContiguousSequenceID)
+	for _, rejection := range ack.Rejections {
+		response += fmt.Sprintf(" %d:%s", rejection.SequenceID, rejection.Reason)
+	}
+
+	_, _ = ctx.Text("%s", response)
+}
+
+func writeNack(ctx iris.Context, asJSON bool, statusCode int, reason ingest.RejectionReason) {
+	ctx.StatusCode(statusCode)
+
+	if asJSON {
+		writeJSON(ctx, struct {
+			Reason ingest.RejectionReason `json:"reason"`
+		}{
+			Reason: reason,
+		})
+		return
+	}
+
+	_, _ = ctx.Text("+CST_NACK %s", reason)
+}
+
+// writeBusy tells the device to back off, with a 429 if it's sending faster than it's allowed to and a 503 if the
+// server is stalled
+func writeBusy(ctx iris.Context, asJSON bool, policy ingest.OverloadPolicy) {
+	statusCode := http.StatusServiceUnavailable
+	if policy == ingest.OverloadReject {
+		statusCode = http.StatusTooManyRequests
+	}
+
+	ctx.Header("Retry-After", "1")
+
+	if asJSON {
+		writeNack(ctx, true, statusCode, ingest.RejectedBusy)
+		return
+	}
+
+	ctx.StatusCode(statusCode)
+	_, _ = ctx.Text("+CST_BUSY")
+}
+
 func main() {
-	in, err := ingest.NewIngester(publicKey)
+	bus, err := common.NewAMQPBus()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	in, err := ingest.NewIngester(publicKey, bus)
 
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	in.Start(1)
+	numWorkers, err := util.GetenvUint("INGEST_WORKERS", uint(runtime.NumCPU()))
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-	app.Get("/session_reset_challenge", func(ctx iris.Context) {
-		app.Logger().Printf("session reset challenge request from %s", ctx.RemoteAddr())
+	in.Start(numWorkers)
+
+	// requests to the bare routes are attributed to ingest.DefaultDeviceID,
+	// other devices use the same routes under /device/{device}
+	deviceID := func(ctx iris.Context) string {
+		if device := ctx.Params().Get("device"); device != "" {
+			return device
+		}
+
+		return ingest.DefaultDeviceID
+	}
+
+	getSessionResetChallenge := func(ctx iris.Context) {
+		device := deviceID(ctx)
+		app.Logger().Printf("session reset challenge request from %s for device %s", ctx.RemoteAddr(), device)
+
+		resetToken, err := in.GetResetChallenge(device)
+		if err != nil {
+			app.Logger().Warnf("session reset challenge request failed with error: %s", err)
+
+			_, _ = ctx.Text("+CST_RESET_FAIL 2")
+			return
+		}
 
-		resetToken := in.GetResetChallenge()
 		_, _ = ctx.Text("+CST_RESET_CHALLENGE %s", resetToken)
-	})
+	}
 
-	app.Post("/session_reset_challenge", func(ctx iris.Context) {
-		app.Logger().Printf("session reset request from %s", ctx.RemoteAddr())
+	postSessionResetChallenge := func(ctx iris.Context) {
+		device := deviceID(ctx)
+		app.Logger().Printf("session reset request from %s for device %s", ctx.RemoteAddr(), device)
 
 		body, err := ctx.GetBody()
 		if err != nil {
@@ -80,40 +174,161 @@ func main() {
 		app.Logger().Printf("r = %s", r)
 		app.Logger().Printf("s = %s", s)
 
-		if err := in.ResetChallengeResponse(string(body)); err == nil {
-			app.Logger().Printf("reset challenge passed, started session %d", in.SessionID())
+		// the generator is negotiated through the query string, e.g. ?algorithm=xoroshiro64ss
+		rngAlgorithm := ctx.URLParamDefault("algorithm", ingest.DefaultRNGAlgorithm)
 
-			_, _ = ctx.Text("+CST_RESET_SUCC " + in.GetInitialRNGVector())
+		if err := in.ResetChallengeResponse(device, string(body), rngAlgorithm); err == nil {
+			app.Logger().Printf("reset challenge passed, started session %d for device %s (%s)", in.SessionID(device), device, rngAlgorithm)
+
+			_, _ = ctx.Text("+CST_RESET_SUCC " + in.GetInitialRNGVector(device))
 		} else {
 			app.Logger().Warnf("reset challenge failed with error: %s", err)
 
 			_, _ = ctx.Text("+CST_RESET_FAIL 0")
 			return
 		}
-	})
+	}
+
+	// responds with an ingest.Ack, either as "+CST_ACK <accepted> <rejected> <highest contiguous seq> [<seq>:<reason>...]"
+	// or as json with ?format=json. batches that are rejected as a whole get a "+CST_NACK <reason>", or a "+CST_BUSY"
+	// if the server is overloaded
+	postPackets := func(ctx iris.Context, parsePackets func([]byte, ecdsa.PublicKey) ([]common.Packet, error)) {
+		asJSON := ctx.URLParamDefault("format", "text") == "json"
 
-	app.Post("/packet/full", func(ctx iris.Context) {
 		body, err := ctx.GetBody()
 		if err != nil {
 			app.Logger().Printf("/packet/x error (body): %s", err)
+			writeNack(ctx, asJSON, http.StatusBadRequest, ingest.RejectedParse)
+			return
 		}
 
 		//app.Logger().Printf("got a packet with body: %s", string(body))
 
-		packets, err := common.ParsePackets[common.FullPacket](body, publicKey)
+		packets, err := parsePackets(body, publicKey)
 
 		if err != nil {
 			app.Logger().Printf("/packet/x error (ParsePacket): %s", err)
+
+			if errors.Is(err, common.ErrBadSignature) {
+				writeNack(ctx, asJSON, http.StatusUnauthorized, ingest.RejectedSignature)
+			} else {
+				writeNack(ctx, asJSON, http.StatusBadRequest, ingest.RejectedParse)
+			}
+
 			return
 		}
 
-		if err = in.NewPackets(packets); err != nil {
+		ack, reason, err := in.NewPackets(ctx.Request().Context(), deviceID(ctx), packets)
+		if err != nil && reason == ingest.RejectedBusy {
+			app.Logger().Warnf("/packet/x error (NewPacket): %s", err)
+			writeBusy(ctx, asJSON, in.OverloadPolicy())
+			return
+		} else if err != nil {
 			app.Logger().Printf("/packet/x error (NewPacket): %s", err)
+			writeNack(ctx, asJSON, http.StatusConflict, reason)
 			return
 		}
-	})
 
-	if err := app.Listen(fmt.Sprintf(":%s", os.Getenv("PRODUCER_PORT"))); err != nil {
-		log.Fatalln(err)
+		writeAck(ctx, asJSON, ack)
+	}
+
+	postFullPacket := func(ctx iris.Context) {
+		postPackets(ctx, common.ParsePackets[common.FullPacket])
+	}
+
+	postEssentialsPacket := func(ctx iris.Context) {
+		postPackets(ctx, common.ParsePackets[common.EssentialsPacket])
+	}
+
+	// packets of types without a struct, e.g. from experimental firmware, are forwarded as they were posted
+	postGenericPacket := func(ctx iris.Context) {
+		postPackets(ctx, common.ParseGenericPackets(ctx.Params().Get("type")))
+	}
+
+	// the stats of the active session, or of any past session of any device with ?session=<id>
+	getSessionStats := func(ctx iris.Context) {
+		var stats ingest.SessionStats
+		var err error
+
+		if sessionID := ctx.URLParamInt64Default("session", 0); sessionID > 0 {
+			stats, err = in.StoredSessionStats(uint(sessionID))
+		} else {
+			stats, err = in.SessionStats(deviceID(ctx))
+		}
+
+		if err != nil {
+			ctx.StatusCode(http.StatusNotFound)
+			_, _ = ctx.Text("%s", err)
+			return
+		}
+
+		writeJSON(ctx, stats)
+	}
+
+	getQueueMetrics := func(ctx iris.Context) {
+		writeJSON(ctx, in.QueueMetrics())
+	}
+
+	// 503s while packets can't be forwarded
+	getHealth := func(ctx iris.Context) {
+		health := in.BusHealth()
+		if health.State != common.BusConnected {
+			ctx.StatusCode(http.StatusServiceUnavailable)
+		}
+
+		writeJSON(ctx, struct {
+			Bus common.BusHealth `json:"bus"`
+		}{
+			Bus: health,
+		})
+	}
+
+	app.Get("/health", getHealth)
+	app.Get("/metrics/queue", getQueueMetrics)
+	app.Get("/session_reset_challenge", getSessionResetChallenge)
+	app.Post("/session_reset_challenge", postSessionResetChallenge)
+	app.Post("/packet/full", postFullPacket)
+	app.Post("/packet/essentials", postEssentialsPacket)
+	app.Post("/packet/{type:string}", postGenericPacket)
+	app.Get("/session_stats", getSessionStats)
+
+	deviceParty := app.Party("/device/{device:string}")
+	deviceParty.Get("/session_reset_challenge", getSessionResetChallenge)
+	deviceParty.Post("/session_reset_challenge", postSessionResetChallenge)
+	deviceParty.Post("/packet/full", postFullPacket)
+	deviceParty.Post("/packet/essentials", postEssentialsPacket)
+	deviceParty.Post("/packet/{type:string}", postGenericPacket)
+	deviceParty.Get("/session_stats", getSessionStats)
+
+	shutdownSignal, stop := common.ShutdownSignalContext()
+	defer stop()
+
+	go func() {
+		if err := app.Listen(fmt.Sprintf(":%s", os.Getenv("PRODUCER_PORT")), iris.WithoutInterruptHandler); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalln(err)
+		}
+	}()
+
+	<-shutdownSignal.Done()
+	log.Println("shutting down")
+
+	ctx, cancel := common.ShutdownContext()
+	defer cancel()
+
+	// no new batches can come in once the http server is down
+	if err := app.Shutdown(ctx); err != nil {
+		log.Printf("failed to shut the http server down: %s", err)
+	}
+
+	if err := in.Stop(ctx); err != nil {
+		log.Printf("failed to drain the packet queue: %s", err)
+	}
+
+	if err := in.Close(); err != nil {
+		log.Printf("failed to close the ingester: %s", err)
+	}
+
+	if err := bus.Close(); err != nil {
+		log.Printf("failed to close the bus: %s", err)
 	}
 }
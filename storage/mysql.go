@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"strings"
+)
+
+// mysqlDialect is the dialect of MySQL and MariaDB, which the queries are written in
+type mysqlDialect struct{}
+
+func mysqlDSN(config config) string {
+	dbConfig := mysql.Config{
+		User:                 config.user,
+		Passwd:               config.password,
+		Addr:                 config.address,
+		DBName:               config.name,
+		Collation:            "utf8mb4_general_ci",
+		Net:                  "tcp",
+		AllowNativePasswords: true,
+		ParseTime:            true,
+	}
+
+	return dbConfig.FormatDSN()
+}
+
+func (mysqlDialect) Name() string {
+	return DriverMySQL
+}
+
+func (mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+func (mysqlDialect) FromUnixTime(placeholder string) string {
+	return fmt.Sprintf("FROM_UNIXTIME(%s)", placeholder)
+}
+
+func (mysqlDialect) Upsert(table string, key []string, columns []string) string {
+	if len(columns) == 0 {
+		// a no-op update rather than INSERT IGNORE, which would turn every other error into a warning as well
+		return fmt.Sprintf("ON DUPLICATE KEY UPDATE %s = %s", key[0], key[0])
+	}
+
+	updates := make([]string, len(columns))
+	for i, column := range columns {
+		updates[i] = fmt.Sprintf("%s = VALUES(%s)", column, column)
+	}
+
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
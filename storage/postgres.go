@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	_ "github.com/lib/pq"
+	"net/url"
+	"strings"
+)
+
+// postgresDialect is the dialect of PostgreSQL, and of TimescaleDB which is an extension of it
+type postgresDialect struct{}
+
+func postgresDSN(config config, sslMode string) string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(config.user, config.password),
+		Host:     config.address,
+		Path:     "/" + config.name,
+		RawQuery: url.Values{"sslmode": {sslMode}}.Encode(),
+	}
+
+	return dsn.String()
+}
+
+func (postgresDialect) Name() string {
+	return DriverPostgres
+}
+
+// Rebind numbers the placeholders, $1, $2 and so on. Question marks within quotes are left alone.
+func (postgresDialect) Rebind(query string) string {
+	var builder strings.Builder
+	builder.Grow(len(query) + 16)
+
+	n := 0
+	var quote rune
+
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			builder.WriteString(fmt.Sprintf("$%d", n))
+			continue
+		}
+
+		builder.WriteRune(c)
+	}
+
+	return builder.String()
+}
+
+func (postgresDialect) FromUnixTime(placeholder string) string {
+	return fmt.Sprintf("to_timestamp(%s)", placeholder)
+}
+
+// Upsert targets the primary key constraint by its name, <table>_pkey, instead of listing the key columns. Turning a
+// table into a hypertable adds the time column to its primary key, the clause still applies but then only catches the
+// rows whose time is the same as well.
+func (postgresDialect) Upsert(table string, key []string, columns []string) string {
+	if len(columns) == 0 {
+		return fmt.Sprintf("ON CONFLICT ON CONSTRAINT %s_pkey DO NOTHING", table)
+	}
+
+	updates := make([]string, len(columns))
+	for i, column := range columns {
+		updates[i] = fmt.Sprintf("%s = EXCLUDED.%s", column, column)
+	}
+
+	return fmt.Sprintf("ON CONFLICT ON CONSTRAINT %s_pkey DO UPDATE SET %s", table, strings.Join(updates, ", "))
+}
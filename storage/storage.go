@@ -0,0 +1,80 @@
+// Package storage opens the database the services keep their sessions and packets in, either MySQL/MariaDB or
+// PostgreSQL, and describes the differences between their SQL.
+//
+// Queries are written with ? placeholders and MySQL-compatible SQL where the two databases agree, and go through
+// Rebind before they're run. The parts that differ, like upserts, come from the Dialect.
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/xor-shift/teleserver/util"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+)
+
+// Dialect describes the SQL of a database
+type Dialect interface {
+	// Name returns the name of the driver, DriverMySQL or DriverPostgres
+	Name() string
+
+	// Rebind rewrites the ? placeholders of a query into the ones of the database
+	Rebind(query string) string
+
+	// FromUnixTime returns an expression converting the unix time in `placeholder` to a timestamp
+	FromUnixTime(placeholder string) string
+
+	// Upsert returns the clause appended to an insert into `table`, whose primary key is `key`, that updates `columns`
+	// of the rows whose key is already taken to the inserted values, or keeps the existing rows if there are no columns
+	Upsert(table string, key []string, columns []string) string
+}
+
+// DB is a database along with its dialect
+type DB struct {
+	*sql.DB
+	Dialect
+}
+
+// Open opens the database selected by DB_DRIVER, either "mysql" (the default, for MySQL and MariaDB) or "postgres",
+// at DB_ADDRESS with DB_USER, DB_PASSWORD and DB_NAME
+func Open() (*DB, error) {
+	config := config{
+		user:     util.GetenvDefault("DB_USER", ""),
+		password: util.GetenvDefault("DB_PASSWORD", ""),
+		address:  util.GetenvDefault("DB_ADDRESS", ""),
+		name:     util.GetenvDefault("DB_NAME", ""),
+	}
+
+	var dialect Dialect
+	var dsn string
+
+	switch driver := util.GetenvDefault("DB_DRIVER", DriverMySQL); driver {
+	case DriverMySQL:
+		dialect, dsn = mysqlDialect{}, mysqlDSN(config)
+	case DriverPostgres:
+		dialect, dsn = postgresDialect{}, postgresDSN(config, util.GetenvDefault("DB_SSLMODE", "disable"))
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown database driver \"%s\"", driver))
+	}
+
+	db, err := sql.Open(dialect.Name(), dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{
+		DB:      db,
+		Dialect: dialect,
+	}, nil
+}
+
+type config struct {
+	user     string
+	password string
+	address  string
+	name     string
+}
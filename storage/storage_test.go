@@ -0,0 +1,37 @@
+package storage
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	query := "SELECT a FROM b WHERE c = ? AND d = '?' AND (e, f) IN ((?, ?))"
+
+	if rebound := (mysqlDialect{}).Rebind(query); rebound != query {
+		t.Fatalf("expected %q got %q", query, rebound)
+	}
+
+	expected := "SELECT a FROM b WHERE c = $1 AND d = '?' AND (e, f) IN (($2, $3))"
+	if rebound := (postgresDialect{}).Rebind(query); rebound != expected {
+		t.Fatalf("expected %q got %q", expected, rebound)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	key := []string{"session_id", "packet_order"}
+
+	cases := []struct {
+		dialect  Dialect
+		columns  []string
+		expected string
+	}{
+		{mysqlDialect{}, nil, "ON DUPLICATE KEY UPDATE session_id = session_id"},
+		{mysqlDialect{}, []string{"a", "b"}, "ON DUPLICATE KEY UPDATE a = VALUES(a), b = VALUES(b)"},
+		{postgresDialect{}, nil, "ON CONFLICT ON CONSTRAINT packets_pkey DO NOTHING"},
+		{postgresDialect{}, []string{"a", "b"}, "ON CONFLICT ON CONSTRAINT packets_pkey DO UPDATE SET a = EXCLUDED.a, b = EXCLUDED.b"},
+	}
+
+	for _, c := range cases {
+		if upsert := c.dialect.Upsert("packets", key, c.columns); upsert != c.expected {
+			t.Fatalf("%s: expected %q got %q", c.dialect.Name(), c.expected, upsert)
+		}
+	}
+}
@@ -26,6 +26,72 @@ uint32_t xoroshiro64s_next(uint32_t (&s)[2]) {
 	return result;
 }
 
+// https://prng.di.unimi.it/xoshiro128plusplus.c
+uint32_t xoshiro128pp_next(uint32_t (&s)[4]) {
+	const uint32_t result = rotl(s[0] + s[3], 7) + s[0];
+
+	const uint32_t t = s[1] << 9;
+
+	s[2] ^= s[0];
+	s[3] ^= s[1];
+	s[1] ^= s[2];
+	s[0] ^= s[3];
+
+	s[2] ^= t;
+
+	s[3] = rotl(s[3], 11);
+
+	return result;
+}
+
+void xoshiro128pp_jump(uint32_t (&s)[4]) {
+	static const uint32_t JUMP[] = { 0x8764000b, 0xf542d2d3, 0x6fa035c3, 0x77f2db5b };
+
+	uint32_t s0 = 0;
+	uint32_t s1 = 0;
+	uint32_t s2 = 0;
+	uint32_t s3 = 0;
+	for(int i = 0; i < sizeof JUMP / sizeof *JUMP; i++)
+		for(int b = 0; b < 32; b++) {
+			if (JUMP[i] & UINT32_C(1) << b) {
+				s0 ^= s[0];
+				s1 ^= s[1];
+				s2 ^= s[2];
+				s3 ^= s[3];
+			}
+			xoshiro128pp_next(s);
+		}
+
+	s[0] = s0;
+	s[1] = s1;
+	s[2] = s2;
+	s[3] = s3;
+}
+
+void xoshiro128pp_long_jump(uint32_t (&s)[4]) {
+	static const uint32_t LONG_JUMP[] = { 0xb523952e, 0x0b6f099f, 0xccf5a0ef, 0x1c580662 };
+
+	uint32_t s0 = 0;
+	uint32_t s1 = 0;
+	uint32_t s2 = 0;
+	uint32_t s3 = 0;
+	for(int i = 0; i < sizeof LONG_JUMP / sizeof *LONG_JUMP; i++)
+		for(int b = 0; b < 32; b++) {
+			if (LONG_JUMP[i] & UINT32_C(1) << b) {
+				s0 ^= s[0];
+				s1 ^= s[1];
+				s2 ^= s[2];
+				s3 ^= s[3];
+			}
+			xoshiro128pp_next(s);
+		}
+
+	s[0] = s0;
+	s[1] = s1;
+	s[2] = s2;
+	s[3] = s3;
+}
+
 // https://prng.di.unimi.it/xoroshiro128plusplus.c
 uint64_t xoroshiro128pp_next(uint64_t (&s)[2]) {
 	const uint64_t s0 = s[0];
@@ -291,7 +357,7 @@ static inline void gen_jump_test(void (*short_jumper)(T(&)[N]), void (*long_jump
             first = false;
 
             short_jumper(state_short);
-            short_jumper(state_long);
+            long_jumper(state_long);
 
             fmt::print("{{");
 
@@ -319,4 +385,7 @@ static inline void gen_jump_test(void (*short_jumper)(T(&)[N]), void (*long_jump
 
 int main() {
     //GENTEST(xoroshiro128pp);
+    //GENJTEST(xoshiro128pp);
+    //GENJTEST(xoroshiro128pp);
+    //GENJTEST(xoshiro256pp);
 }
\ No newline at end of file
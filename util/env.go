@@ -0,0 +1,65 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// GetenvDefault returns the value of an environment variable, or `def` if it's unset or empty
+func GetenvDefault(key string, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return def
+}
+
+// GetenvUint parses an environment variable as an unsigned integer, returning `def` if it's unset or empty
+func GetenvUint(key string, def uint) (uint, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("bad value for %s: %s", key, err))
+	}
+
+	return uint(parsed), nil
+}
+
+// GetenvDuration parses an environment variable as a time.Duration (e.g. "1500ms"), returning `def` if it's unset
+// or empty
+func GetenvDuration(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("bad value for %s: %s", key, err))
+	}
+
+	return parsed, nil
+}
+
+// GetenvBool parses an environment variable as a boolean ("true", "false", "1", "0" etc.), returning `def` if it's
+// unset or empty
+func GetenvBool(key string, def bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("bad value for %s: %s", key, err))
+	}
+
+	return parsed, nil
+}
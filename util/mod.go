@@ -1,7 +1,9 @@
 package util
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"unsafe"
 )
 
@@ -25,3 +27,24 @@ func ArrayToString[T uint8 | uint16 | uint32 | uint64](arr []T) string {
 
 	return ret
 }
+
+// StringToArray is the inverse of ArrayToString, it fills `arr` with the values encoded in `str`.
+func StringToArray[T uint8 | uint16 | uint32 | uint64](str string, arr []T) error {
+	var zero T
+	digits := int(unsafe.Sizeof(zero) * 2)
+
+	if len(str) != digits*len(arr) {
+		return errors.New(fmt.Sprintf("bad string length (expected %d, got %d)", digits*len(arr), len(str)))
+	}
+
+	for i := range arr {
+		v, err := strconv.ParseUint(str[i*digits:(i+1)*digits], 16, digits*4)
+		if err != nil {
+			return err
+		}
+
+		arr[i] = T(v)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package rng
+
+import "sync"
+
+// advanceTable holds the transition matrix of a generator raised to every power of two that fits in a uint64.
+//
+// The state transitions of the xoshiro/xoroshiro family are linear over GF(2), so advancing a state by `n` steps is
+// the same as multiplying it by the n-th power of the transition matrix. The matrices are stored column-wise, column
+// `j` of a matrix being the image of the state with only its j-th bit set.
+type advanceTable[T uint32 | uint64] struct {
+	once     sync.Once
+	stateLen int
+	permute  func([]T) T
+
+	powers [64][][]T
+}
+
+func newAdvanceTable[T uint32 | uint64](stateLen int, permute func([]T) T) *advanceTable[T] {
+	return &advanceTable[T]{
+		stateLen: stateLen,
+		permute:  permute,
+	}
+}
+
+// multiply sets `out` to the product of the matrix `m` and the vector `v`
+func multiply[T uint32 | uint64](m [][]T, v []T, out []T) {
+	bits := wordBits[T]()
+
+	for i := range out {
+		out[i] = 0
+	}
+
+	for j, column := range m {
+		if (v[j/bits]>>(j%bits))&1 == 0 {
+			continue
+		}
+
+		for i := range out {
+			out[i] ^= column[i]
+		}
+	}
+}
+
+func (table *advanceTable[T]) init() {
+	bits := table.stateLen * wordBits[T]()
+
+	transition := make([][]T, bits)
+	for j := range transition {
+		column := make([]T, table.stateLen)
+		column[j/wordBits[T]()] = T(1) << (j % wordBits[T]())
+		_ = table.permute(column)
+		transition[j] = column
+	}
+
+	table.powers[0] = transition
+
+	for k := 1; k < len(table.powers); k++ {
+		prev := table.powers[k-1]
+		squared := make([][]T, bits)
+
+		for j := range squared {
+			squared[j] = make([]T, table.stateLen)
+			multiply(prev, prev[j], squared[j])
+		}
+
+		table.powers[k] = squared
+	}
+}
+
+// advance moves `state` forward by `n` steps in O(log n) matrix-vector products
+func (table *advanceTable[T]) advance(state []T, n uint64) {
+	table.once.Do(table.init)
+
+	scratch := make([]T, len(state))
+
+	for k := 0; n != 0; k, n = k+1, n>>1 {
+		if n&1 == 0 {
+			continue
+		}
+
+		multiply(table.powers[k], state, scratch)
+		copy(state, scratch)
+	}
+}
+
+var (
+	xoroshiro64AdvanceTable    = newAdvanceTable(2, xoroshiro64SPermuteState)
+	xoshiro128AdvanceTable     = newAdvanceTable(4, xoshiro128PPPermuteState)
+	xoroshiro128AdvanceTable   = newAdvanceTable(2, xoroshiro128PPermuteState)
+	xoroshiro128PPAdvanceTable = newAdvanceTable(2, xoroshiro128PPPermuteState)
+	xoshiro256AdvanceTable     = newAdvanceTable(4, xoshiro256PPermuteState)
+)
+
+// jump polynomials from the reference implementations
+var (
+	xoshiro128Jump64Table = []uint32{0x8764000b, 0xf542d2d3, 0x6fa035c3, 0x77f2db5b}
+	xoshiro128Jump96Table = []uint32{0xb523952e, 0x0b6f099f, 0xccf5a0ef, 0x1c580662}
+
+	xoroshiro128Jump64Table = []uint64{0xdf900294d8f554a5, 0x170865df4b3201fc}
+	xoroshiro128Jump96Table = []uint64{0xd2a98b26625eee7b, 0xdddf9b1090aa7ac1}
+
+	xoroshiro128PPJump64Table = []uint64{0x2bd7a6a6e99c2ddc, 0x0992ccaf6a6fca05}
+	xoroshiro128PPJump96Table = []uint64{0x360fd5f2cf8d5d99, 0x9c6e6877736c46e3}
+
+	xoshiro256Jump128Table = []uint64{0x180ec6d33cfd0aba, 0xd5a61266f0c9392c, 0xa9582618e03fc9aa, 0x39abdc4529b1661c}
+	xoshiro256Jump192Table = []uint64{0x76e15d3efefdcbbf, 0xc5004e441c522fb3, 0x77710069854ee241, 0x39109bb02acbe635}
+)
+
+// Xoroshiro64Advance moves a [2]uint32 xoroshiro64 (* or **) state forward by `n` steps.
+func Xoroshiro64Advance(s []uint32, n uint64) {
+	xoroshiro64AdvanceTable.advance(s, n)
+}
+
+// Xoshiro128Advance moves a [4]uint32 xoshiro128 (+, ++ or **, they share the same state transition) state forward by
+// `n` steps as if the generator was called `n` times.
+func Xoshiro128Advance(s []uint32, n uint64) {
+	xoshiro128AdvanceTable.advance(s, n)
+}
+
+// Xoroshiro128Advance moves a [2]uint64 xoroshiro128 (+ or **) state forward by `n` steps.
+// xoroshiro128++ uses different constants, see Xoroshiro128PPAdvance.
+func Xoroshiro128Advance(s []uint64, n uint64) {
+	xoroshiro128AdvanceTable.advance(s, n)
+}
+
+// Xoroshiro128PPAdvance moves a [2]uint64 xoroshiro128++ state forward by `n` steps.
+func Xoroshiro128PPAdvance(s []uint64, n uint64) {
+	xoroshiro128PPAdvanceTable.advance(s, n)
+}
+
+// Xoshiro256Advance moves a [4]uint64 xoshiro256 (+, ++ or **) state forward by `n` steps.
+func Xoshiro256Advance(s []uint64, n uint64) {
+	xoshiro256AdvanceTable.advance(s, n)
+}
@@ -0,0 +1,209 @@
+package rng
+
+import "testing"
+
+func testAdvance[T uint32 | uint64](t *testing.T, initial []T, advance func([]T, uint64), permute func([]T) T) {
+	stepped := append([]T{}, initial...)
+	jumped := make([]T, len(initial))
+
+	for steps := uint64(0); steps <= 4096; steps++ {
+		copy(jumped, initial)
+		advance(jumped, steps)
+
+		for i := range stepped {
+			if jumped[i] != stepped[i] {
+				t.Fatalf("After %d steps expected %X got %X", steps, stepped, jumped)
+			}
+		}
+
+		_ = permute(stepped)
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	t.Run("xoroshiro64", func(t *testing.T) {
+		testAdvance(t, []uint32{0xEA5469FE, 0x705AC12C}, Xoroshiro64Advance, xoroshiro64SSPermuteState)
+	})
+
+	t.Run("xoshiro128", func(t *testing.T) {
+		testAdvance(t, []uint32{0xEA5469FE, 0x705AC12C, 0x1C2DF95B, 0xBC435DED}, Xoshiro128Advance, xoshiro128SSPermuteState)
+	})
+
+	t.Run("xoroshiro128", func(t *testing.T) {
+		testAdvance(t, []uint64{0x7EABC93DE333C567, 0x10F33A74D9654DC9}, Xoroshiro128Advance, xoroshiro128SSPermuteState)
+	})
+
+	t.Run("xoroshiro128++", func(t *testing.T) {
+		testAdvance(t, []uint64{0x7EABC93DE333C567, 0x10F33A74D9654DC9}, Xoroshiro128PPAdvance, xoroshiro128PPPermuteState)
+	})
+
+	t.Run("xoshiro256", func(t *testing.T) {
+		testAdvance(t, []uint64{0x46A2399E3C169544, 0x8FF6DC0B9795017B, 0xE80291DA5D126190, 0x138EBAE4A31FE0C9}, Xoshiro256Advance, xoshiro256SSPermuteState)
+	})
+}
+
+// testJump checks the short and long jumps against vectors from testgen, if `advance` is not nil, a short jump is also
+// checked against two calls to it
+func testJump[S comparable](t *testing.T, s S, expected [][2]S, shortJump, longJump, advance func(*S)) {
+	short := s
+	long := s
+
+	for i, vec := range expected {
+		if advance != nil {
+			advanced := short
+			advance(&advanced)
+			advance(&advanced)
+
+			if advanced != vec[0] {
+				t.Errorf("At advance %d expected %v got %v", i, vec[0], advanced)
+			}
+		}
+
+		shortJump(&short)
+		longJump(&long)
+
+		if short != vec[0] {
+			t.Errorf("At jump %d expected %v got %v", i, vec[0], short)
+		}
+
+		if long != vec[1] {
+			t.Errorf("At long jump %d expected %v got %v", i, vec[1], long)
+		}
+	}
+}
+
+func TestJumpXoshiro128PP(t *testing.T) {
+	vectors := []struct {
+		s  [4]uint32
+		vs [][2][4]uint32
+	}{
+		{[4]uint32{0x0AA09F1D, 0x37D25C10, 0xCA57A513, 0x47CD16FB}, [][2][4]uint32{{{0xEE595F91, 0x7AF05775, 0x8E4E5B23, 0x8FDAEA87}, {0xF2F93195, 0x7901876A, 0x762183E0, 0xBABC0D3A}}, {{0x8F97B27F, 0xF3451CBF, 0xB0E4AEAF, 0xA8DB05B9}, {0xE6B3734E, 0x33EEAEBC, 0xB80B71EF, 0x50F1F12A}}, {{0x24B3A374, 0xD5B8416D, 0xD379AA65, 0x2E518481}, {0x76CFFB3A, 0xC5AFA31F, 0xD406046D, 0x9F86CFAE}}, {{0xD0C4BE31, 0xB62FC0D3, 0x7E7F9D41, 0x2AC0D80B}, {0x0B209B8B, 0xB8C13A40, 0xB263B8B6, 0x9F8257C4}}, {{0x60D0720C, 0x6091CE8F, 0xD14B4293, 0xD0379CE2}, {0x3C888DA6, 0x6D4CD994, 0x11B68073, 0xD081B50B}}, {{0x5F6CA8AE, 0x2CB8DF93, 0x7FA19CAB, 0x0F7494E8}, {0x990C354C, 0x348C15EA, 0xCF5EEF4F, 0x9B701AE8}}, {{0x4B342DF7, 0x894C4A2B, 0x5F4B55D0, 0xD5BB842E}, {0x367CDD2F, 0x2A8CABAA, 0x6CA3981F, 0xAFEACEE7}}, {{0xF44CA23D, 0x3944D7F6, 0x32615E32, 0x6672DD0F}, {0x17E9BDFE, 0x07067591, 0x03ABDC50, 0x919450B3}}}},
+		{[4]uint32{0x17539107, 0x37BEE3E4, 0xEB6823B4, 0xC1A9EABC}, [][2][4]uint32{{{0x4D416AB5, 0xFD75028D, 0x38CBE073, 0x1DE3071E}, {0xF3AB1D16, 0x36D2357D, 0xF8BDFF15, 0x7D7E006E}}, {{0xE1BC429A, 0x98F9042A, 0xFBCA0998, 0xC204FBF5}, {0x24DB39E8, 0xC1FAF664, 0x2A974715, 0xE40B3D84}}, {{0xF6738740, 0x45D08B99, 0x317BD751, 0xF97BA621}, {0xDF884A42, 0xDD198FD2, 0xC8968AD2, 0xA275620B}}, {{0xC29FAF7C, 0x296E40A6, 0x7CB1D026, 0xBD8F666C}, {0x9404B985, 0xF9D533FC, 0x8D3008AC, 0x9ED190E8}}, {{0x577DDDE1, 0xC7246FD5, 0x7F000DA5, 0xF5179473}, {0x839F9D37, 0xA6701F77, 0x1222ADCA, 0x916C55A6}}, {{0x891190E8, 0x5B4371FA, 0xFEAB1ACF, 0xE536BA89}, {0xBF59AE24, 0x8794A37E, 0xB27E753A, 0x3EEA80BC}}, {{0x9046B7DC, 0xCBDDAF1C, 0x315CC91E, 0x578E9F03}, {0xD02E3A68, 0x516C42BF, 0x344D9ADF, 0x874125E1}}, {{0x75A5EA39, 0x61A7A816, 0x48E721CA, 0xD05F9A23}, {0xA8796285, 0x248FEC8D, 0x18FF3106, 0xD20ABD43}}}},
+		{[4]uint32{0x5130656B, 0x45BCDF62, 0xBC9256B7, 0xC50466BC}, [][2][4]uint32{{{0x96EAB990, 0xFFDDF90A, 0xF4825CDB, 0x00137B3F}, {0x675BC317, 0x7CC014C2, 0x5A358629, 0x3503ADD1}}, {{0xB9896D73, 0x956AE38B, 0xA5AF7F81, 0x70178F37}, {0xB7323B72, 0xAF76085D, 0xDC457F0C, 0x08ACCA9C}}, {{0x4804C90A, 0xB1859032, 0x40463845, 0xC383ED76}, {0x9AFD32FD, 0x57EF5130, 0x13277F70, 0xFB165951}}, {{0x9EA268C5, 0x9C9130F0, 0x880B84E5, 0x20D5E0E0}, {0xCB6E3998, 0x3AA3AC89, 0x6C351AF0, 0xA5047A58}}, {{0xF51BB36D, 0x7BB873A3, 0x1B7AA07F, 0xC8DF1CFA}, {0xAA9CB0F9, 0x365EB4CC, 0xF6525535, 0x06863AB1}}, {{0xF104A946, 0x0E58B09B, 0x9639497A, 0xD2C99218}, {0x3D0D3D54, 0xFAFD2D87, 0x3C9E3F3A, 0xAB58AD4E}}, {{0x968E6F14, 0x149F3DA1, 0x2C58FBF8, 0x6715A9F0}, {0xA3F57E98, 0x60B0A3EB, 0x6AB67B98, 0x169B1176}}, {{0x0728DE3B, 0x90D4A51A, 0x0459C0EE, 0x58FCA5ED}, {0x531CE7F7, 0xE94C26AC, 0xAD8968AF, 0xE212E11F}}}},
+		{[4]uint32{0x2016E50B, 0xCBB7A096, 0x68E5802F, 0xD381177F}, [][2][4]uint32{{{0x93F14DF7, 0x6093A864, 0x707C483D, 0x7B134031}, {0x104D4F86, 0xDD80A969, 0xD1FA0075, 0x6D4BD512}}, {{0xA9F5FACE, 0x36B98166, 0xD15921AE, 0xDE4C639A}, {0x57F6B8A4, 0x62558429, 0x4A4E71D3, 0x72934560}}, {{0xBDB086BD, 0x3B4F7405, 0x94FE7723, 0xCF71CA6D}, {0xCD5B7E1C, 0x080252D7, 0xD5F98067, 0x4AE6979D}}, {{0xFA1F04E2, 0xFD021487, 0x62FB173C, 0x2AE5838C}, {0xE5B8B7A5, 0x837A28DE, 0x21CA5519, 0x31C6AC8B}}, {{0xB456FCE8, 0x6CE4F4A7, 0xF530EE03, 0x026E2900}, {0x4270F168, 0x8E3B3630, 0xB2329E40, 0x0A55BB50}}, {{0xF307023C, 0xD4338D27, 0x9C5A8050, 0x15D81A09}, {0x477F1350, 0x640A5089, 0xD885B0BF, 0x52377C58}}, {{0x9FEFB13E, 0x6522C1F6, 0x6B3DC53F, 0x454C3891}, {0x14680678, 0x1DBC0933, 0x396D2A3A, 0x13C25B23}}, {{0x7C7B30D4, 0xD8D1BC42, 0x5494989D, 0x217E2167}, {0x8F517A00, 0xC50FA880, 0xDBA81D6B, 0xE6E007D9}}}},
+		{[4]uint32{0x37738D1A, 0xCC077CF4, 0xFA8CF071, 0x4A0EEF10}, [][2][4]uint32{{{0x166EE977, 0x53A6E211, 0x5000AF43, 0xC52C6A78}, {0xFE4FC09F, 0x3519C696, 0x71BD53EF, 0x47C04AEC}}, {{0x33B91298, 0x41E0114F, 0x7F3065A6, 0xFF7D6578}, {0xCE8373EA, 0x5711A30C, 0x56B13E21, 0x3BCD61BE}}, {{0x31914D33, 0x043DF57D, 0x85F194AB, 0xA403B0AB}, {0x137C4771, 0xE3C7AAE9, 0x15B72A81, 0x8C67AA5E}}, {{0x05E5F1DF, 0x7968A2FC, 0xD75DEBDA, 0xEE43F916}, {0x9CA3BC2D, 0x4FCEBBFB, 0x9D2E0C61, 0x492FBCC9}}, {{0x46F48BC2, 0xBA43CB6C, 0xE2930AD3, 0x3DE507F8}, {0xB9A720F1, 0xF3B05FAC, 0xBCF823C1, 0x027F0292}}, {{0x571C4301, 0x25698211, 0xFC9D319D, 0xB3C6DBB3}, {0x0B18F462, 0xD12FA519, 0xCBDF4677, 0x7BF21B97}}, {{0x331BD3A0, 0x486896F9, 0x542EA604, 0x0234AFBA}, {0x006882AD, 0x7967223A, 0xFB6EE0E3, 0x278548DE}}, {{0x5B5C47E8, 0x2B84992B, 0x67613FB2, 0xF5C2241F}, {0x79D02BCA, 0x38FAABFC, 0x22B919FF, 0x04687167}}}},
+		{[4]uint32{0x04AEF38B, 0x6FB14ACB, 0x5059A2D8, 0x46758AAB}, [][2][4]uint32{{{0x558F9B9C, 0x5719A3CB, 0x6D3F7B4D, 0xC5E5C649}, {0xA9948A5B, 0x5CF925F1, 0x5CFC4B9B, 0x556065DD}}, {{0x7FC5A89B, 0xE5AB56EE, 0x0D8951E1, 0x50362CC4}, {0x1AFBB2BC, 0x98C07E86, 0xF1EBAA57, 0xDC4C54C4}}, {{0x12A702B0, 0xEECF676C, 0x17919774, 0x5F180D09}, {0x56B14439, 0xF04CFA4C, 0x21BDB03B, 0x8A09A66A}}, {{0xD5C79060, 0x0BC290DE, 0x1862D9E0, 0xA4209E1A}, {0x2C44F775, 0x919409C5, 0xFB3B7EFB, 0x05067BBD}}, {{0xD179A506, 0xD84A5BF1, 0x3059E671, 0x9932C161}, {0x70426E47, 0x26635EBF, 0x51D62E7F, 0x06BA0159}}, {{0xF513B3FF, 0xB4588B6A, 0xB5FDF1BB, 0xE012B6A2}, {0xB04BA818, 0x24060566, 0x298043CB, 0xAC9F982B}}, {{0x3D6B15FE, 0x8E20122A, 0x61D7BF79, 0x279DCF3E}, {0x5E62B6AC, 0x3044899C, 0x4405C177, 0x0F8F5976}}, {{0xDAC2D7AE, 0xC6F7B984, 0x1BB18F71, 0xB4FEAFFE}, {0x3A04354E, 0x6CABB7A9, 0x31FE4448, 0xB332480B}}}},
+		{[4]uint32{0xD4F12521, 0x6BB433DF, 0xA5D9399F, 0x2EE3E0DF}, [][2][4]uint32{{{0x3FFCD4CA, 0xF3611C26, 0x47D8279E, 0x412CCA63}, {0x23850217, 0x5046F695, 0x1F7B8F38, 0x789E4F16}}, {{0xB5D3C752, 0x47016B1E, 0x9738C91B, 0xCBDA0F0D}, {0x494DD583, 0xFF7A1E1B, 0xF786DBD3, 0x9B15F810}}, {{0x9D179E39, 0xB51825C9, 0x66C13D7D, 0x6A468AE9}, {0xCB8D5D11, 0x54BDB46F, 0x34EFEB78, 0xC69DC5E6}}, {{0x5631E73E, 0x959EFC7F, 0x13E16D00, 0xD5C73B37}, {0x35C8F56A, 0x1F60C66F, 0xB5FF0947, 0x88D5FD4C}}, {{0xD3F2E4BE, 0x0678196D, 0x6F7D8A5F, 0x9D650230}, {0x4400C2B7, 0xAFAAB568, 0xFB8AF334, 0xCE1F19BA}}, {{0x431372C0, 0xD4FADCE3, 0x244D9CDF, 0x1599E802}, {0x083BB9F0, 0xF65D0A82, 0xD06350D1, 0xFE2F42B8}}, {{0xA3CECDDC, 0x003185B4, 0x4AB48674, 0xA2B95E48}, {0xAA202363, 0x253D6E74, 0xA1DD99C5, 0x86142C73}}, {{0x5C27F1DF, 0xF908964D, 0x1E7BCC36, 0xD9F24160}, {0xAAEC5B96, 0x0D419C2D, 0x96D88A05, 0x521E8D3E}}}},
+		{[4]uint32{0xEDE574B0, 0x1EA9B641, 0x3772A57E, 0xC3354F91}, [][2][4]uint32{{{0xBBBA8616, 0x13A6015F, 0x5CCBA8B1, 0x176E9ED4}, {0xE9338879, 0x23DF25A7, 0x33B4CD11, 0xF629F787}}, {{0x4F4C4111, 0x4B99A46E, 0x85AD2EE6, 0x0C3EDDD4}, {0xFAB765FC, 0x428A2C04, 0x6DC05AF1, 0x79EC82DB}}, {{0x1E94A474, 0x964DE208, 0xB5F75804, 0x6C898C00}, {0x3134BFC4, 0xFD097A01, 0x9706916B, 0xC580796D}}, {{0x2E3D7C50, 0x953224FA, 0xC9011067, 0x2ACE4ED7}, {0xE466EF15, 0x3C068A1F, 0xA865070E, 0x775F44BB}}, {{0x46D6CF93, 0xF7F0718D, 0x3AB698B3, 0x8897A346}, {0xEE112213, 0xD0507442, 0x1C502AEF, 0x3A3EE681}}, {{0x59C9D2BC, 0x0157570B, 0x4BBEA2C8, 0xBCE49C3A}, {0x16CD5A6B, 0x7ECF9E95, 0x03358277, 0x48739376}}, {{0xD3F9CA10, 0x0E431C19, 0xC41B7FA5, 0xC8FEC961}, {0xBACAB7F6, 0x92FF99AA, 0xCB3748C8, 0x0296232D}}, {{0x38A0333B, 0x497EA2BA, 0xA634205F, 0xF214E62B}, {0x7AE36853, 0x5FF5EBA2, 0x7255A397, 0xA83C338F}}}},
+	}
+
+	for _, vec := range vectors {
+		testJump(t, vec.s, vec.vs, func(s *[4]uint32) {
+			state := NewXoshiro128PP()
+			_ = state.SetState(s[:])
+			state.Jump64()
+			copy(s[:], state.State())
+		}, func(s *[4]uint32) {
+			state := NewXoshiro128PP()
+			_ = state.SetState(s[:])
+			state.Jump96()
+			copy(s[:], state.State())
+		}, func(s *[4]uint32) {
+			Xoshiro128Advance(s[:], 1<<63)
+		})
+	}
+}
+
+func TestJumpXoroshiro128PP(t *testing.T) {
+	vectors := []struct {
+		s  [2]uint64
+		vs [][2][2]uint64
+	}{
+		{[2]uint64{0xA34E2FABDF909C33, 0xC0A19E6320195BD0}, [][2][2]uint64{{{0xB283943317BC1C40, 0x48CE906BE4B08579}, {0xE7A1BE601D9936F3, 0x9E06CAA83F9E4804}}, {{0x1E8B35F338570970, 0x4776F86D7FDB0761}, {0xF69E17AC4560F03B, 0x7F1817502DF66AE3}}, {{0x437C6FEC08C38A0C, 0xFC768606E82754A6}, {0x2BE61F50F28EBDD0, 0xC65B95445A32E3D6}}, {{0x7836E2533EF51275, 0x070C4166EFBA0E72}, {0xAFF587A5CC531E53, 0xA710E7E165F573CC}}, {{0x2EF44AB40A0F3BBE, 0xFDCC36341159AB10}, {0x407F81E155ED8324, 0xBD4320CF09D2DF02}}, {{0xE672543BD7196B75, 0x0A35EB9A9FE5A7D1}, {0x3AB2D76D66A8B15C, 0xA5A87DDA349915A1}}, {{0x5B659CA2A369C93C, 0x5B94F6979F9ECB02}, {0x6F07B19C1E9E6DA7, 0xC53B351F6FBF8B19}}, {{0x5A6DF4011CBE516E, 0x82E5FBF9BB78BBBD}, {0x520C63341AE2D43E, 0x3F1268BCD5D8B25E}}}},
+		{[2]uint64{0x8CD9031D36692F11, 0x2E78F2AE5EAAC89C}, [][2][2]uint64{{{0xBF8AA9A37F7DB2B1, 0xF13C7F4E0818E4AD}, {0x3E5C56CE5B646D97, 0xBB9F1FB960BFE261}}, {{0x3F283F245A298D5C, 0x4F124EB960DBE440}, {0xF4843666A3BC3EFF, 0x12C1E9F84BF764A8}}, {{0x9F2A757C433AE736, 0xDF82CB8032C5FA02}, {0x86FF3D23779F61AB, 0x3284D93107C123E7}}, {{0x45093F8BADA98DE4, 0x8FB55E61EA8CA12D}, {0xA382809F47678EDF, 0xD3262237B9159B67}}, {{0x66EDDFA59BF42E83, 0x49D63179B2FB7FEB}, {0xB62368472FD5AB21, 0x033F9D525D7C9FB9}}, {{0x244C65E741082862, 0xF37A5CE010E3D805}, {0x1F98028E488A52A5, 0xB2B61F12928B7D63}}, {{0x472D53937496054F, 0x4CB38F92CDEDEC31}, {0x97515346BFB0BC33, 0x5AD7162DA3D19591}}, {{0x64945A56A442A4CE, 0x8F6C14B6C16E1702}, {0xB5D84BC4A5D7BF52, 0x82EDD4D45F6A3E75}}}},
+		{[2]uint64{0x1874AEAC6F406824, 0xC653EC6A4A7536A5}, [][2][2]uint64{{{0xE889EBC5630AC798, 0x38ECEE733B0A1296}, {0x81DB96825B9EF438, 0x3209C7BF6EB0093F}}, {{0xE8289AFA5495B53D, 0x74DAD718A57213F9}, {0x72B6162AD10AC5A6, 0x33670E9D477A5D9E}}, {{0x076DDC56E827C4AE, 0x90560C81061B6FF7}, {0x4078FF7DF27D2D67, 0xFB3538300E98BFA3}}, {{0x7F84605CD75A8C12, 0x4D8BBDF226020DCC}, {0xD377CCA269EE1C16, 0x7756F2BEC98F0378}}, {{0xCC0899891E271EB3, 0x898AFED8C7FB1839}, {0x6202D87342EFAB9F, 0xDEC66211BE1F1F22}}, {{0x2C748DEEEFC64D6F, 0x2FCC51EE026DA3A6}, {0x1DB5E9E4EEFDBDAE, 0x27706AD784785941}}, {{0x00AAFCE60D439009, 0x995DEEBB8293A86F}, {0x40AF68210437D9BB, 0x8D3A6F4E47A65540}}, {{0x548B9D1C2D1916E5, 0xD55A05CEFE9EB720}, {0xE812C5565B16C916, 0x6CB666E280BC4239}}}},
+		{[2]uint64{0xB02A2DAE25A8E752, 0xDB4737561C956CC0}, [][2][2]uint64{{{0xC6A1DBB3C6552C54, 0x4C3C15A0BCDC5919}, {0x04138D9EC494C421, 0x579E765B574992E8}}, {{0x9397A45B7A155A1C, 0x593FA6F54B0F1B2E}, {0x683DE293B116FFA7, 0xCB1479520E057FC3}}, {{0x1F087A1AC00DA137, 0x0719197495352961}, {0xF64B4E116C270C08, 0xF850EFD1E34822EA}}, {{0x1CA1ED718BAD4367, 0x22B52BA1EE959CE4}, {0x367BA4E116958C85, 0x4DEBC38EF52646D9}}, {{0x13BE795680B6D5BF, 0xE9294B54E9AFFE4F}, {0x6F05427184578998, 0x14239FBD6C92E503}}, {{0xE524D3AD3FE210D1, 0xC674535334ADFCC3}, {0x962020B7DB92E758, 0xEE15F1735FB54051}}, {{0x1B325C8845F06BD8, 0xCE31C56CFFAA00E1}, {0x33E1554C46F83132, 0x0602E2F54C8A3B27}}, {{0x1B5358F68AF9FCCA, 0x4A5C2AC81D257CDC}, {0x99C8E18C37059A4F, 0x0167D003B31F8421}}}},
+		{[2]uint64{0x1E59CA0238A8D193, 0xCF681A8ADE5A42C1}, [][2][2]uint64{{{0xCF9E888079BAE5C4, 0x69DAB7CBB0F800C9}, {0xA2F8A0BB1616F2EE, 0x643136AE75960D93}}, {{0x54020218E518FC7B, 0x305969C2D5ECC39F}, {0xCDD333C573DC32D7, 0x394B3C86DA1A53B1}}, {{0xF3894E62B7AB2D59, 0xAD4ADABDB893F980}, {0x8F16341FDE399D24, 0xD60E1233F1C3EFD3}}, {{0x9192D7A3CCE65284, 0xC8FACA63D331AB22}, {0xC62EAA95C397CF2D, 0xB5DBD759542BD229}}, {{0xDB2820DC26396FF7, 0x41089218BACC49C9}, {0x9E8BCC8943AFFB2C, 0xD3AAE0A733286E1A}}, {{0xA18F8B6BAE65D5F0, 0x1C7ED313FF5BCA2D}, {0x5847065505B59884, 0xBB5D91FDD0A28E47}}, {{0x09B171C42DF9870E, 0x6D8D1E18643015F5}, {0x7F8B89FFA88059D9, 0xDE729D9E88BB1719}}, {{0xD767FD2E34C0C89F, 0xFFDAE0533D133544}, {0x16FB44651938FEAC, 0xAF4AC71863664E86}}}},
+		{[2]uint64{0x6680EFEF16AB18F6, 0xFFF1F0ABD2282066}, [][2][2]uint64{{{0x7BDCE8478632A7D5, 0x9128D49FE04022C3}, {0xFE9CF159E3B7FC09, 0xBA4C195457DB7945}}, {{0x1968B8C53C834D74, 0x885270720637ED38}, {0x7F627A30989AE8E3, 0xB8882C95F7BD56EB}}, {{0xB770DC06162BF945, 0x7339D20D3CE22943}, {0x11F0FE7D865996C0, 0xA5973B7746B4149C}}, {{0x915F9474126BC085, 0x25FCE11E8170D78F}, {0x9F18E1197CB7BB70, 0x5228FC1A29951710}}, {{0x1072612CD37F3F61, 0x0BD56FBA0F3A735B}, {0x9C67D85F44770571, 0x9116A726681BA2D8}}, {{0xDAF6CD8B31DAF234, 0x228A9CD4CB5E9BC2}, {0x036801A15584A954, 0x16F8739106106423}}, {{0x275BDC69076B1488, 0x5CAA749D471FEBAE}, {0xB3C26131FCCF70B8, 0xCE6642DFB57658FB}}, {{0x3523BD33ACB1866A, 0x81057D82F310BF67}, {0x9D07AA77C6AC5BFC, 0x337B5D501109ACE6}}}},
+		{[2]uint64{0x1230AC80FE58A3FF, 0xC550EF9A05F1B231}, [][2][2]uint64{{{0x13A3DCCD8BED0C0A, 0xA10714EE036416B3}, {0x5B37EB546150664E, 0x43106E6FB2FDE371}}, {{0xEBE30DAC63F400D2, 0x9CA41E904C2E55E6}, {0xC7508927B5838229, 0xA551AF7104EFBE6B}}, {{0x78E36D9289B83EC6, 0xDDECFC0F6FA3FE3B}, {0x4C7521FB2ECAAA2B, 0x712FD28C12B4BF2E}}, {{0x850AD89D269627AB, 0x953FD05B90B458E3}, {0x6B4945B1C5819906, 0x6EEF0AC166206578}}, {{0xEAE051E34975DB13, 0x1EDAEB8592208A97}, {0x199D5C820CB1A8E1, 0x71E6C3D3B7317678}}, {{0x92F7799216BC3B78, 0xE00C8D4D9446DCDD}, {0xFDAE3A566DB7A6F5, 0x0A20054E36714288}}, {{0x7A6EF385FB082E1E, 0x5252C5681AA62992}, {0xD9A0A333E897773C, 0x95955B5535C77C37}}, {{0x0180A00CAA5CAA4A, 0xE26EC36FD3770FAF}, {0x8595D12AAF976B94, 0x3F34C37204AE69F9}}}},
+		{[2]uint64{0x4B86241F009BC6FB, 0xAFCD0902E9B4A8B0}, [][2][2]uint64{{{0xBDD57A67702D043F, 0x4833F84FA64B59C2}, {0xE89F54D4FD8B7652, 0x4C7599CB46842A29}}, {{0x9A6DF7E6234AA035, 0x790E15E41374692C}, {0x82CD57C0162C7300, 0xBE18B10E149D8624}}, {{0x24221F9F9A69FC91, 0xE50FCCC43A42A2FA}, {0x9CC0B9A62781BA65, 0xB9CC25E6AB24B34E}}, {{0x4F075C803BD237D2, 0x891AA6284EA37577}, {0x67F9CDFC6E41F868, 0x41CFF89B913355FF}}, {{0x26CAB14EF1CED4CB, 0x4F60E48A26240F51}, {0x186F9A39B27525E6, 0x1F1CC39583964B9D}}, {{0xD13619A586952F54, 0x114BF36327D1E335}, {0x5A5304A218457F63, 0xE468E76A43C7B5F2}}, {{0x8FA45686C4339425, 0xEBA78FBA6BA48AC7}, {0x6CD5E61E9C8A6EF0, 0x24E94576844336D0}}, {{0x5D8C2ADAAD9C908C, 0x9A2C5D23D516A435}, {0xD1BF7554A9CACFE5, 0xAF0302C4C028B186}}}},
+	}
+
+	for _, vec := range vectors {
+		testJump(t, vec.s, vec.vs, func(s *[2]uint64) {
+			state := NewXoroshiro128PP()
+			_ = state.SetState(s[:])
+			state.Jump64()
+			copy(s[:], state.State())
+		}, func(s *[2]uint64) {
+			state := NewXoroshiro128PP()
+			_ = state.SetState(s[:])
+			state.Jump96()
+			copy(s[:], state.State())
+		}, func(s *[2]uint64) {
+			state := NewXoroshiro128PP()
+			_ = state.SetState(s[:])
+			state.Advance(1 << 63)
+			copy(s[:], state.State())
+		})
+	}
+}
+
+func TestJumpXoshiro256PP(t *testing.T) {
+	vectors := []struct {
+		s  [4]uint64
+		vs [][2][4]uint64
+	}{
+		{[4]uint64{0xBA0282746F64F6F7, 0x177F6B459A80462C, 0x357D7016B6EEF9DF, 0x2DD4A1FA1E3E6D79}, [][2][4]uint64{{{0x4ADA3C4D95DED42A, 0x955D9791EE438BF5, 0xD81C533751215D1C, 0x8E9CA9F01C149295}, {0xF95543C774746543, 0x4299E7B5B4992F41, 0x716E2EC690D2A133, 0x2DC93B949480FCC3}}, {{0xBCC47CB016AF251F, 0x2F7F872035A2ECC1, 0x9D63369AC20DF91E, 0xC35DA14F8B780687}, {0xC11EC2C83835DB6C, 0xB51C5DF59E2509D3, 0x8550FBAD86E62A56, 0xF634453B0E34AD80}}, {{0x709EEB903BB10038, 0xABF27FD11836AFC0, 0xF7CB9BE8241174EA, 0x0CC34DF709533ABE}, {0xA6DA03DE552387B0, 0xD9CAF0D63E65EBEA, 0x8763195939F31AD1, 0x1931DA5D15377769}}, {{0x81483C1E3A6B33FD, 0x25A2F0745671D23E, 0x8BE3563C74223322, 0x3787CB7DC5B568CF}, {0xF4DFC1494FB9FB03, 0x75CAA9B83865DE08, 0xF5AD62E1E30C81F6, 0xCFE5CCB7A802D021}}, {{0xC48170D795E979DE, 0xEABFDFCBEF14D824, 0xD959725F7DB80B7D, 0x89F46F6F81EFCAA1}, {0x2458DFE360C678E1, 0xE2FA870EB678313A, 0xBE7FFD93CDA5E7CD, 0x34A8FDE1409E5CA7}}, {{0x1B4B87A7599B475B, 0x74A2535EC69158CD, 0xF026D56846ED5A16, 0x924C717ADA18F048}, {0x7FB062EA011C2831, 0xDB94C7DA4953761F, 0x84B0375AE78E1EEA, 0xB8C1962C146610A4}}, {{0xAA4DDD4FE98EE293, 0xF7166E48D616F795, 0xFAC42F34465D69E8, 0x8B19C066CDFDA685}, {0x42FCB5EA6D69FC8C, 0x9A3DE74C91777BF0, 0x45F1DA8CA854937F, 0x7C9F52FA04E4680E}}, {{0xBEA349CE30742B43, 0xAF7F3F7C9FDEDD6C, 0x3536806E82C0B88A, 0x97608F751F46109D}, {0x1A341C148975EBC8, 0xE1B8DA74DB0D0A55, 0x50F40F22C28C6A9B, 0x1D2D7CD138AA49CB}}}},
+		{[4]uint64{0xB82A3C5AB2D1DF89, 0x4C89FE4357704176, 0x63834BAB74C67302, 0x60CA381C8387643F}, [][2][4]uint64{{{0x40D99DF50B0E9B43, 0x577E8D917D028295, 0x567A88B7F11AE827, 0x4A3186DA5DD29C68}, {0x9F5ACD581BE8B662, 0x373F3EC9FFDC8185, 0xCDE1C4E5FC31F84B, 0x9AF09D981B9542BA}}, {{0x8DB57845843B9B32, 0x555BB4233C4BA2DE, 0xF4D16BDA7551450A, 0xB263E1872BB9AA30}, {0x0EFE10B807571DA5, 0x5E8E8E9907899CE7, 0x418D7EC72D2D03E7, 0x1FFF9B0510AB7719}}, {{0xC4C0FAB44A356EE0, 0x3B81CAAF49B3A179, 0xE71AE5834C191285, 0xA7AFA71ECD8268D7}, {0x6E8B64878693ED08, 0xB541F12C7D72A687, 0x089607FE5B986F45, 0x839C65D69DDFE976}}, {{0x35FFD5630468523D, 0xAAC9506FD74BB245, 0x329B988E3118527B, 0xCA674E909940B620}, {0x09C14E50680AFA34, 0x94D096A582935936, 0x46A93BD4ADF60F59, 0xCC7DFC35F4BFFE95}}, {{0x3F315F30A6EA1D84, 0x7EC4D66DEF65AAE5, 0xDA482CEAC8F9BDC2, 0x6353B4B490351A65}, {0x662FBDEECC0644E2, 0xD409DEFB830D0A86, 0xD8EE4C70027F5A09, 0xF16290F0632325F0}}, {{0x2413C8197D27A3A3, 0x864C748E5D5BF5B8, 0xA33EFFDFD1420DEC, 0x384B48DAB0985899}, {0x2AABAA28FF2376CA, 0xA60B619069F64798, 0x5818A95DAC54801E, 0xE439AF63B830C9BB}}, {{0x67F047A86B36DC19, 0x78D1C2A61DE1E4D4, 0x4E205EE181B251F6, 0xB9505382E528C11A}, {0x88895D7363E802AD, 0xD35D1E76BB8B0904, 0x705D23ED04E8C63F, 0xC25ACE91B09BDE63}}, {{0x1A63B37122F0C69F, 0xD9FCC5C995A6EAA3, 0xC4E62DA719857B00, 0x5FD0B5CBF239E7CD}, {0xF7E7C58B667C25F2, 0xCC8AE2932FED9834, 0x0CAC734E5A2A9E64, 0x504957E8B50A09FE}}}},
+		{[4]uint64{0xA35BFF263D28C93F, 0x51FE48E983F8F7B9, 0x17A7BC50418D5D5D, 0xB23C5BB908CAADF0}, [][2][4]uint64{{{0xFF39F7F2618BE1DD, 0x966DF77BBCCFB116, 0xE9A20FFCC593B405, 0x46FCCDA522B66F02}, {0x15F540EA7B74322A, 0xD3AE6279E775D97C, 0x238D84E8BB28F688, 0x4192B47D37EF213D}}, {{0x75269375D79991A2, 0xD76D0F1220CA3612, 0x2CF64326A62F7AF8, 0x26E5E6B9FB9DB626}, {0xD03B20C47B46FBEC, 0xC819783D148217F8, 0xCD73E5F38CE7FFC4, 0x2014E861F05D44AC}}, {{0xCA78024CF722CFE7, 0x1B73E059795E9FC5, 0xBCBD27263FD0E205, 0xBED96D040E796782}, {0x2D4671E2F5E783BE, 0x7173EEF92849D0ED, 0xBAFD2B300C3FC10C, 0x845E2ABB93870989}}, {{0x6269DF67D0DE2531, 0xA893CEF16368EFF3, 0x8B41D03987573A7E, 0xAD9189C86C2953DF}, {0xF0DB2119ABB4702B, 0x528E21B785033F6E, 0xE575CF23E829FC6F, 0x1A8625F68B04AEEE}}, {{0xDBD01A29D76E838D, 0xE725A9735596D3E0, 0xBC49143F37CF9B48, 0x7EF6A97618F28D79}, {0x051503265B282EF1, 0x5873CEBD7F42562A, 0xA31EEB726E7DD91A, 0x3E64A202F519CA6B}}, {{0x710AA6B16CA8D6EF, 0xCB0E9E2A2A04F2F3, 0xFEAD817BE91B2F8D, 0x440F0A17FA69E77A}, {0x0C4C9AB0216B9AC7, 0x4EAD01BC8CF91AD6, 0x3FD8B60D94BC753E, 0x523D24C15BBC562F}}, {{0x8E83170287411CAB, 0xA7C513404C2FF785, 0x7478B2B9E3F21A11, 0xB80C7ACF676D0B0C}, {0xDBCBF1A9AEDA9ACD, 0xE746CC99E38F4C81, 0x9FF0A5CABCC27DDF, 0x53CB813DC33F51F7}}, {{0xF7A9991FE69CE462, 0x7566C26F43A00D0F, 0x6B460306CF484EF6, 0xE7B56520D30CC7B1}, {0x1085A61F16337D72, 0x9C42C0CBFC86AEFE, 0x3328BCB14191EB1D, 0x5A6AD9B11A739F7F}}}},
+		{[4]uint64{0xC285E95B3353034B, 0x28AF8B83EAD3A40E, 0xA330EB650A33559F, 0xC9DDB314931C55E1}, [][2][4]uint64{{{0x5B830D88F3244BE0, 0xBFB7F73BED73B0D8, 0x76F53DF2534BD727, 0x65197A9F1E9F787A}, {0x185818CBE3281450, 0xB8E6AAF72F4C04AF, 0x74F4E3DBC7188B3E, 0x95FAA5BF238D6BAA}}, {{0x48E24DBFF628672C, 0x6F920D401E48A769, 0x86DE0F0EECC11F12, 0x65F2F27C0DEEF614}, {0xF75D77005F502BE1, 0xFDF5BA4950B83FF6, 0x51953E010F220649, 0x2720D0842349BB40}}, {{0xE5E030CCBBB87AA4, 0x8BAE764ACBB06BB8, 0xA606B2E3C992BA38, 0xA140428B96F66D04}, {0x45116CCD6CCB5FF5, 0xCCCE9222EDDC1D29, 0x6DA4932A0CBF7248, 0x4BD9CFA7098D798C}}, {{0x27636FE012C22DF7, 0x156EDACD0C2166A0, 0x684D1D85D7F01046, 0x5FC25ABEA428C6BE}, {0xFA872DDBCE1A5CC6, 0x9A2F8BAA7319837F, 0xD565F735B5D5F662, 0x2506A6930CAF5E6A}}, {{0x1A88054CAB88E2C1, 0xBDE9D5A4D23F78E2, 0x7AB831E8918241C6, 0x503729324F2C3BDD}, {0xADA5E975D806E655, 0x712CEA1C101B94F7, 0x549DD89EDF1611A3, 0xC6D17FD350A175D4}}, {{0xC1DC2050E73CAD8E, 0x8E3DFF3FDBF26BA3, 0xECB91143EE933B66, 0x0D2F19272ED9AECB}, {0x0B9BA1F1EBD7695C, 0x1C9319A9EE5640FA, 0x29F0E21E2B7539BA, 0x56D92374A00E1B22}}, {{0xF44D414439379594, 0x86DC18BEA60E41B3, 0x672B55E58A5B5747, 0xFE69729BB522E0CC}, {0x546C7A3E760F1F5C, 0xAB7251AC4793E7E5, 0x4D9F12A9D1B12656, 0x07C3CAD85C192223}}, {{0xF65724880C5BDE46, 0xC35F10603EA39E81, 0xD793099FA712E285, 0x53E7C44EC9FB5CED}, {0x6EADD662F10ED872, 0x89DD965272A14BA0, 0x87C68EEAA71E60EF, 0xA5605F5498A4BFE4}}}},
+		{[4]uint64{0x1F1B07D7307AECA2, 0xEF274C19E79682FF, 0x5B71EE75511080A9, 0x28F02A11C91198EB}, [][2][4]uint64{{{0x4CBAA169CBB95C41, 0x8656722230F0E855, 0x7A7FCCD03FAB1581, 0x1D54FD1CC7C43A35}, {0xF3ED1FF4192E565A, 0x9C70A1115ECE1BE1, 0xD414032DDBE50051, 0xDCF30A5ACB05EEA9}}, {{0xFA9D966C6B0A4E81, 0x1D0446AC52748035, 0x1D9E15FD388D93B8, 0xC66D9B081CE15010}, {0xC8E82756868414C9, 0x5855664E79347487, 0x679740D4B188934E, 0xD4880F9A6230C8A9}}, {{0xD4476E8A5C7AD0D0, 0x00580E2CEC8B09C2, 0xEC3A11C769F1D7CA, 0x671AEBF79747A138}, {0x896A7878B5E9C56F, 0x45A186042D8D2EBB, 0xB3620C89481E6D8C, 0xF50F831A3616BBED}}, {{0x077796A653DE61DA, 0x76B1B28505EF75C9, 0x93F01F5AD6647151, 0xE2850B0D4868A6DD}, {0x3B3FD58240CDDF80, 0xAF29FA4F01079F25, 0xA884DDD3315C638B, 0x7A2B9A2D37BE7916}}, {{0xDB8B5A3A41D6698A, 0x155B952C6703BA25, 0x53E6A0048F72654E, 0x31231DC1D577BC48}, {0xB970B27B086525B8, 0x248A03F6653024BB, 0x8673D4545B86B660, 0x431E284DE358D43D}}, {{0x2C11F91C1F42100E, 0x99F0855ECB0E37A0, 0x14270A92CF5F5F72, 0xEC9579C79951863D}, {0x1D2D7B1913C2E18B, 0x02EA9D75EE776D28, 0xCE9B736B15B393D0, 0x54D6BF7903DE4EB9}}, {{0xAF3BDA2BFACAA8EC, 0x504716BB1F350F9F, 0x962107D4403604D5, 0x52AB629AA3F73803}, {0xC5C83CB76BB636AB, 0x424D20BF75FAC613, 0xCEE0022050BCDDA4, 0x8117BDEA05541BCE}}, {{0xD601E7E518F618F9, 0x2C16B2175FDD872A, 0x06F52C4AC1D42BDB, 0x53436E50334B98E9}, {0xFF6881718FE8ADA1, 0x3940A8B01BFB66B9, 0x40BF5815F13FBDCF, 0x292DAB6F7AC4B5F7}}}},
+		{[4]uint64{0xB33323964A5A6C06, 0x435839A9262599FB, 0x522064EBE2B39FE7, 0xBCCD2E8153186189}, [][2][4]uint64{{{0x5C36676BC8395F19, 0x911908F1E3B32E7D, 0xC95DE6F71FB669F5, 0xE9CDCAA3FCA0CE9B}, {0x59ABF897A833187B, 0xC9A883D3BA184AA8, 0x90C327DE80A9A85C, 0x6E7167F2F613E184}}, {{0x389072D37005F0F7, 0xB3BF3A5FCD6C98DF, 0xABE0C60B0EBE3530, 0x61B849BB9AFAC70D}, {0x9CCB807595F12623, 0x4E883BC514686099, 0xD59722D1CFCDDCA0, 0x36D79E5BB71B7F84}}, {{0xCB32809FBB09D392, 0x9428A28336F58245, 0x6F531FB1F04E5388, 0x7AC6FD22B1444009}, {0x8DE1111BDB1191E4, 0xF84E29FD91F5C82A, 0x39ADD1AF9BFA0A89, 0x6803830D12A157C0}}, {{0xD4BC5533C69C2AF2, 0xDADD436E57CFCBC1, 0x49FC39620C5F7341, 0xB94B2BA12B8AB038}, {0x6FE6893FB60EC31E, 0x55C83A693BE9AEF6, 0xCEF94207BC3A4AF5, 0xAA1ED1BF8760132F}}, {{0xF63CF2364FDECEF7, 0xEB9BF38B2841DA90, 0x0F45571545AB0D9C, 0x65802CEDD5C6B94C}, {0xD9492833112BC66F, 0x6F768E411137CE6E, 0x571E134CD498218B, 0xE4A4602A2DD56A26}}, {{0xFAFC4A788C951062, 0x4254F3B4049AAB94, 0x16AD5AB3C6F7AFC8, 0x1DF7296B871C46E5}, {0xE4773B7AF9CFD577, 0x74CB962344E81B60, 0x80F1F218DD1AD820, 0x171F14AB60CCED3E}}, {{0xDBAEED1F2543B5A7, 0x2FBC45FCF1C6F8EC, 0xF14EE40FFFA50742, 0x0689C6A1581A10A3}, {0xA4CDB555E33C8F21, 0xA4B71382D6EBB1A0, 0x963A4D1D5EF6BB16, 0xBF0641691B55EE6D}}, {{0x9E0861596BAC4688, 0x2767F65CBB0C7DC9, 0x9E85EB2E5A7C0BE4, 0x2168E2DDEC9B7221}, {0x01E4339958436547, 0xBE2DBB82DDBC6429, 0x348F72BBAE226697, 0x9A2650461DC70FDD}}}},
+		{[4]uint64{0x630012E7AB00334C, 0xAA3B221150BF4F7F, 0x15C34B8A23ED3F9E, 0xB11AC26607516C97}, [][2][4]uint64{{{0x5957C586D256371F, 0x4A675D7F04DFA59A, 0xA8CA7EAD7C947662, 0xD4C60B41A84D7797}, {0xD63C33B7BA922905, 0x447B20CDB5DD0165, 0x24CFCBDC07F71866, 0xB5183601493CF33E}}, {{0x9472DC937A63FD1F, 0x59C2135613D0CBB5, 0xE2EB8EEBD81DF941, 0xCD5C8A3059B412F6}, {0x9019CD6C4C3248EF, 0x4D9D7A751B98812A, 0x3AA8148111275043, 0x4CFCF2B1634B56AF}}, {{0x18F2E2F4DF499561, 0xC50EFBC0200BE685, 0x02BD7EA8ACD8A86D, 0xDADC78E937FCA48B}, {0x5283F332121392FE, 0x76CC95427F12350D, 0x2E482C26BC13AA0F, 0xD9211C5663728579}}, {{0x9DCF348E8E8766EC, 0x09DC43C27BEAF9F4, 0x81AD38513A1C8734, 0xFA663F1A7C35EAB6}, {0x87BD2852EC0AB197, 0x04146B61D281288E, 0x9D1DFB6217AD7511, 0x8BBC76D377F75D26}}, {{0xEC4E567B9F5491BB, 0xB55556D6E14D4DF4, 0xA8DA70C56816B0DB, 0x7213C9A68F61FED0}, {0x7BE087EAD4A1683C, 0x9FA9FEF49A731A8A, 0x07387EA39F402197, 0xBFB32DB3002C5BC7}}, {{0x91F8959E99E24B66, 0x758ED48215D316A5, 0xB9337CA15BA87D70, 0x38482CB6FBFCACAB}, {0xC77A96421BCA1B27, 0x7CF48DC41C5E9D5F, 0xD4B7CBB23E5D58C9, 0x892C1C30AFAAE521}}, {{0xB51E2FD3FC61DFE0, 0x788C07C9DBF85F09, 0x4B6F70E6EC6EB736, 0x2CAFF671380EA8CC}, {0xBD5DB36682C28467, 0x8D48F6EDAA22EF4A, 0x0F657417EDD6499B, 0x5142DD3D10BF4B55}}, {{0x65A9EE6F3AB63BE3, 0xE1CEB026EA69FEF4, 0x31020C5D3E99513B, 0x52814D8332E0A33F}, {0x339C055318B9ED47, 0x6A8BD434C1F930A6, 0x5A1D01875274E887, 0x60E50DC075BF25A1}}}},
+		{[4]uint64{0x2246817BBDEAB6F7, 0x88155D8F847BA569, 0x2C3228BB63BEEAC8, 0xD1A6294286D91850}, [][2][4]uint64{{{0x37ECBB6D01723298, 0xE76A0439D1BDC1C6, 0x537783E35D907EC9, 0xB9FEA5B60BD4FBCC}, {0x8B1B39A261FEB219, 0xDEA7C95A716DD3DB, 0xBD614B52024DC8C8, 0x2F171C75F19411EC}}, {{0x83B233B9DCED7C81, 0xBF7C2D1D05B0762E, 0xB3F2B8C8CDA3E90C, 0x7A779E10E93BF98F}, {0x6DF84DA70D6A632B, 0x76C08E2CF4462E75, 0x4FB0CA9242C42C99, 0xA425FC5672146E91}}, {{0xF4ECF067003E110E, 0xBE425E8D51AE42A8, 0x004C6CDA4C0246E1, 0xC6212FD12010E5A4}, {0x61F29B7DC3002C11, 0xC5B1A6C32B1B0F5F, 0x8CC5841BA8830F33, 0xC5D1E05566A5714B}}, {{0x5EF45FD4592293A0, 0xCFAC4C83ACBA5964, 0x53258DE7C298684F, 0x0AFA6DF85D2CCDA2}, {0x53922325437CD714, 0x7E17DDEF02DBEA96, 0x19C4EAECDCE49B8E, 0x273EF9068EC48A0A}}, {{0xA9EC906F906A475B, 0xAF2FC18FA3BFB53F, 0x0FE4F2D374D7DB5B, 0x71B430427407790F}, {0xACC12402F42BA8E4, 0xD6EFC55678AC78D1, 0xA92DB3E952F564F4, 0x5E00628CBF816B30}}, {{0x9E7845D882913007, 0x413B0D7C97B96E3A, 0x071FA4A41D25172E, 0xEAE213746CADB8E5}, {0x38457CAD100977AE, 0x01C9BD5F2F7A9E69, 0x33A01AFCEDD22B3C, 0x1690FA7B67D85435}}, {{0xEA0EF34337B1720B, 0x61867F9811863098, 0x0048AEC3B7879D79, 0xAFF2AA6701B4E30E}, {0xAE0AD58FA8F25804, 0x69B4F508B80782D2, 0xA90A790E90850730, 0x7B44FD4CB2F3AD1E}}, {{0xFE9EC1947F6E8764, 0xAA4829BEB9B193E0, 0x9D68E4DD1F68D0CC, 0xDEB130C76EDF8E67}, {0xE19AE84B808E4749, 0x99AB4165AC14226E, 0x6B0ED33CD922B9E0, 0x236459C1B35DA1FB}}}},
+	}
+
+	for _, vec := range vectors {
+		testJump(t, vec.s, vec.vs, func(s *[4]uint64) {
+			state := NewXoshiro256PP()
+			_ = state.SetState(s[:])
+			state.Jump128()
+			copy(s[:], state.State())
+		}, func(s *[4]uint64) {
+			state := NewXoshiro256PP()
+			_ = state.SetState(s[:])
+			state.Jump192()
+			copy(s[:], state.State())
+		}, nil)
+	}
+}
+
+// TestJump checks the jumps of the generators that don't have testgen vectors against two advances by 2^63 steps
+func TestJump(t *testing.T) {
+	for _, name := range []string{"xoshiro128p", "xoshiro128ss", "xoshiro128pp"} {
+		jumped, _ := NewGenerator32(name)
+		advanced, _ := NewGenerator32(name)
+		_ = jumped.SetState([]uint32{0xEA5469FE, 0x705AC12C, 0x1C2DF95B, 0xBC435DED})
+		_ = advanced.SetState(jumped.State())
+
+		jumped.Jump()
+		advanced.Advance(1 << 63)
+		advanced.Advance(1 << 63)
+
+		for i, v := range jumped.State() {
+			if v != advanced.State()[i] {
+				t.Errorf("Jump of %s expected %X got %X", name, advanced.State(), jumped.State())
+				break
+			}
+		}
+	}
+
+	for _, name := range []string{"xoroshiro128p", "xoroshiro128ss", "xoroshiro128pp"} {
+		jumped, _ := NewGenerator64(name)
+		advanced, _ := NewGenerator64(name)
+		_ = jumped.SetState([]uint64{0x7EABC93DE333C567, 0x10F33A74D9654DC9})
+		_ = advanced.SetState(jumped.State())
+
+		jumped.Jump()
+		advanced.Advance(1 << 63)
+		advanced.Advance(1 << 63)
+
+		for i, v := range jumped.State() {
+			if v != advanced.State()[i] {
+				t.Errorf("Jump of %s expected %X got %X", name, advanced.State(), jumped.State())
+				break
+			}
+		}
+	}
+}
@@ -1,11 +1,114 @@
 package rng
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"unsafe"
+)
+
+// Generator32 is implemented by every generator with 32-bit outputs
+type Generator32 interface {
+	Next() uint32
+	// Jump advances the generator by a fixed, large number of steps, the distance depends on the generator
+	Jump()
+	// Advance advances the generator by `n` steps as if Next was called `n` times
+	Advance(n uint64)
+	// State returns a copy of the generator's state
+	State() []uint32
+	SetState(state []uint32) error
+}
+
+// Generator64 is implemented by every generator with 64-bit outputs
+type Generator64 interface {
+	Next() uint64
+	// Jump advances the generator by a fixed, large number of steps, the distance depends on the generator
+	Jump()
+	// Advance advances the generator by `n` steps as if Next was called `n` times
+	Advance(n uint64)
+	// State returns a copy of the generator's state
+	State() []uint64
+	SetState(state []uint64) error
+}
+
+var generators32 = map[string]func() Generator32{
+	"xoroshiro64s":  func() Generator32 { return NewXoroshiro64S() },
+	"xoroshiro64ss": func() Generator32 { return NewXoroshiro64SS() },
+	"xoshiro128p":   func() Generator32 { return NewXoshiro128P() },
+	"xoshiro128ss":  func() Generator32 { return NewXoshiro128SS() },
+	"xoshiro128pp":  func() Generator32 { return NewXoshiro128PP() },
+}
+
+var generators64 = map[string]func() Generator64{
+	"xoroshiro128p":  func() Generator64 { return NewXoroshiro128P() },
+	"xoroshiro128ss": func() Generator64 { return NewXoroshiro128SS() },
+	"xoroshiro128pp": func() Generator64 { return NewXoroshiro128PP() },
+	"xoshiro256p":    func() Generator64 { return NewXoshiro256P() },
+	"xoshiro256ss":   func() Generator64 { return NewXoshiro256SS() },
+	"xoshiro256pp":   func() Generator64 { return NewXoshiro256PP() },
+}
+
+// NewGenerator32 returns a zero-state generator by its name, e.g. "xoshiro128pp" or "xoroshiro64ss"
+func NewGenerator32(name string) (Generator32, error) {
+	if constructor, ok := generators32[name]; ok {
+		return constructor(), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("unknown 32-bit generator \"%s\"", name))
+}
+
+// NewGenerator64 returns a zero-state generator by its name, e.g. "xoshiro256pp" or "xoroshiro128ss"
+func NewGenerator64(name string) (Generator64, error) {
+	if constructor, ok := generators64[name]; ok {
+		return constructor(), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("unknown 64-bit generator \"%s\"", name))
+}
+
+func sortedNames[T any](generators map[string]T) []string {
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Generators32 returns the names of the generators that can be passed to NewGenerator32
+func Generators32() []string {
+	return sortedNames(generators32)
+}
+
+// Generators64 returns the names of the generators that can be passed to NewGenerator64
+func Generators64() []string {
+	return sortedNames(generators64)
+}
+
+func wordBits[T uint8 | uint16 | uint32 | uint64]() int {
+	var v T
+	return int(unsafe.Sizeof(v) * 8)
+}
+
+func setStateImpl[T uint32 | uint64](dst []T, src []T) error {
+	if len(src) != len(dst) {
+		return errors.New(fmt.Sprintf("bad state length (expected %d, got %d)", len(dst), len(src)))
+	}
+
+	copy(dst, src)
+
+	return nil
+}
+
+// jumpImpl advances `state` by the distance encoded in the jump polynomial `table`
 func jumpImpl[T uint8 | uint16 | uint32 | uint64](state []T, table []T, permute func([]T) T) {
 	s := make([]T, len(state))
 
 	for i := 0; i < len(table); i++ {
-		for b := 0; b < 64; b++ {
-			if (table[i] ^ 1<<b) != 0 {
+		for b := 0; b < wordBits[T](); b++ {
+			if (table[i] & (T(1) << b)) != 0 {
 				for j := 0; j < len(state); j++ {
 					s[j] ^= state[j]
 				}
@@ -14,7 +117,5 @@ func jumpImpl[T uint8 | uint16 | uint32 | uint64](state []T, table []T, permute
 		}
 	}
 
-	for j := 0; j < len(state); j++ {
-		s[j] ^= state[j]
-	}
+	copy(state, s)
 }
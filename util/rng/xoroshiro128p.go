@@ -0,0 +1,56 @@
+package rng
+
+import "fmt"
+
+// Xoroshiro128PState is a xoroshiro128+ generator
+// https://prng.di.unimi.it/xoroshiro128plus.c
+type Xoroshiro128PState struct {
+	s [2]uint64
+}
+
+func NewXoroshiro128P() *Xoroshiro128PState {
+	state := Xoroshiro128PState{
+		s: [2]uint64{0, 0},
+	}
+
+	return &state
+}
+
+func (state *Xoroshiro128PState) Next() uint64 {
+	return xoroshiro128PPermuteState(state.s[:])
+}
+
+// Jump advances the generator by 2^64 steps
+func (state *Xoroshiro128PState) Jump() {
+	state.Jump64()
+}
+
+func (state *Xoroshiro128PState) Jump64() {
+	jumpImpl(state.s[:], xoroshiro128Jump64Table, xoroshiro128PPermuteState)
+}
+
+func (state *Xoroshiro128PState) Jump96() {
+	jumpImpl(state.s[:], xoroshiro128Jump96Table, xoroshiro128PPermuteState)
+}
+
+func (state *Xoroshiro128PState) Advance(n uint64) {
+	Xoroshiro128Advance(state.s[:], n)
+}
+
+func (state *Xoroshiro128PState) State() []uint64 {
+	return append([]uint64{}, state.s[:]...)
+}
+
+func (state *Xoroshiro128PState) SetState(s []uint64) error {
+	return setStateImpl(state.s[:], s)
+}
+
+func (state *Xoroshiro128PState) String() string {
+	s := ""
+
+	for i := 0; i < len(state.s); i++ {
+		s += fmt.Sprintf("%016X", state.s[i])
+	}
+
+	return s
+}
@@ -0,0 +1,56 @@
+package rng
+
+import "fmt"
+
+// Xoroshiro128SSState is a xoroshiro128** generator
+// https://prng.di.unimi.it/xoroshiro128starstar.c
+type Xoroshiro128SSState struct {
+	s [2]uint64
+}
+
+func NewXoroshiro128SS() *Xoroshiro128SSState {
+	state := Xoroshiro128SSState{
+		s: [2]uint64{0, 0},
+	}
+
+	return &state
+}
+
+func (state *Xoroshiro128SSState) Next() uint64 {
+	return xoroshiro128SSPermuteState(state.s[:])
+}
+
+// Jump advances the generator by 2^64 steps
+func (state *Xoroshiro128SSState) Jump() {
+	state.Jump64()
+}
+
+func (state *Xoroshiro128SSState) Jump64() {
+	jumpImpl(state.s[:], xoroshiro128Jump64Table, xoroshiro128SSPermuteState)
+}
+
+func (state *Xoroshiro128SSState) Jump96() {
+	jumpImpl(state.s[:], xoroshiro128Jump96Table, xoroshiro128SSPermuteState)
+}
+
+func (state *Xoroshiro128SSState) Advance(n uint64) {
+	Xoroshiro128Advance(state.s[:], n)
+}
+
+func (state *Xoroshiro128SSState) State() []uint64 {
+	return append([]uint64{}, state.s[:]...)
+}
+
+func (state *Xoroshiro128SSState) SetState(s []uint64) error {
+	return setStateImpl(state.s[:], s)
+}
+
+func (state *Xoroshiro128SSState) String() string {
+	s := ""
+
+	for i := 0; i < len(state.s); i++ {
+		s += fmt.Sprintf("%016X", state.s[i])
+	}
+
+	return s
+}
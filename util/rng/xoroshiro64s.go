@@ -1,15 +1,48 @@
 package rng
 
+import "fmt"
+
+// Xoroshiro64SState is a xoroshiro64* generator
+// https://prng.di.unimi.it/xoroshiro64star.c
 type Xoroshiro64SState struct {
-	State [2]uint32
+	s [2]uint32
 }
 
 func NewXoroshiro64S() *Xoroshiro64SState {
-	return &Xoroshiro64SState{
-		State: [2]uint32{0, 0},
+	state := Xoroshiro64SState{
+		s: [2]uint32{0, 0},
 	}
+
+	return &state
 }
 
 func (state *Xoroshiro64SState) Next() uint32 {
-	return xoroshiro64SPermuteState(state.State[:])
+	return xoroshiro64SPermuteState(state.s[:])
+}
+
+// Jump advances the generator by 2^32 steps, there is no reference jump polynomial for xoroshiro64*
+func (state *Xoroshiro64SState) Jump() {
+	state.Advance(1 << 32)
+}
+
+func (state *Xoroshiro64SState) Advance(n uint64) {
+	Xoroshiro64Advance(state.s[:], n)
+}
+
+func (state *Xoroshiro64SState) State() []uint32 {
+	return append([]uint32{}, state.s[:]...)
+}
+
+func (state *Xoroshiro64SState) SetState(s []uint32) error {
+	return setStateImpl(state.s[:], s)
+}
+
+func (state *Xoroshiro64SState) String() string {
+	s := ""
+
+	for i := 0; i < len(state.s); i++ {
+		s += fmt.Sprintf("%08X", state.s[i])
+	}
+
+	return s
 }
@@ -0,0 +1,48 @@
+package rng
+
+import "fmt"
+
+// Xoroshiro64SSState is a xoroshiro64** generator
+// https://prng.di.unimi.it/xoroshiro64starstar.c
+type Xoroshiro64SSState struct {
+	s [2]uint32
+}
+
+func NewXoroshiro64SS() *Xoroshiro64SSState {
+	state := Xoroshiro64SSState{
+		s: [2]uint32{0, 0},
+	}
+
+	return &state
+}
+
+func (state *Xoroshiro64SSState) Next() uint32 {
+	return xoroshiro64SSPermuteState(state.s[:])
+}
+
+// Jump advances the generator by 2^32 steps, there is no reference jump polynomial for xoroshiro64**
+func (state *Xoroshiro64SSState) Jump() {
+	state.Advance(1 << 32)
+}
+
+func (state *Xoroshiro64SSState) Advance(n uint64) {
+	Xoroshiro64Advance(state.s[:], n)
+}
+
+func (state *Xoroshiro64SSState) State() []uint32 {
+	return append([]uint32{}, state.s[:]...)
+}
+
+func (state *Xoroshiro64SSState) SetState(s []uint32) error {
+	return setStateImpl(state.s[:], s)
+}
+
+func (state *Xoroshiro64SSState) String() string {
+	s := ""
+
+	for i := 0; i < len(state.s); i++ {
+		s += fmt.Sprintf("%08X", state.s[i])
+	}
+
+	return s
+}
@@ -0,0 +1,56 @@
+package rng
+
+import "fmt"
+
+// Xoshiro128PState is a xoshiro128+ generator
+// https://prng.di.unimi.it/xoshiro128plus.c
+type Xoshiro128PState struct {
+	s [4]uint32
+}
+
+func NewXoshiro128P() *Xoshiro128PState {
+	state := Xoshiro128PState{
+		s: [4]uint32{0, 0, 0, 0},
+	}
+
+	return &state
+}
+
+func (state *Xoshiro128PState) Next() uint32 {
+	return xoshiro128PPermuteState(state.s[:])
+}
+
+// Jump advances the generator by 2^64 steps
+func (state *Xoshiro128PState) Jump() {
+	state.Jump64()
+}
+
+func (state *Xoshiro128PState) Jump64() {
+	jumpImpl(state.s[:], xoshiro128Jump64Table, xoshiro128PPermuteState)
+}
+
+func (state *Xoshiro128PState) Jump96() {
+	jumpImpl(state.s[:], xoshiro128Jump96Table, xoshiro128PPermuteState)
+}
+
+func (state *Xoshiro128PState) Advance(n uint64) {
+	Xoshiro128Advance(state.s[:], n)
+}
+
+func (state *Xoshiro128PState) State() []uint32 {
+	return append([]uint32{}, state.s[:]...)
+}
+
+func (state *Xoshiro128PState) SetState(s []uint32) error {
+	return setStateImpl(state.s[:], s)
+}
+
+func (state *Xoshiro128PState) String() string {
+	s := ""
+
+	for i := 0; i < len(state.s); i++ {
+		s += fmt.Sprintf("%08X", state.s[i])
+	}
+
+	return s
+}
@@ -0,0 +1,56 @@
+package rng
+
+import "fmt"
+
+// Xoshiro128PPState is a xoshiro128++ generator
+// https://prng.di.unimi.it/xoshiro128plusplus.c
+type Xoshiro128PPState struct {
+	s [4]uint32
+}
+
+func NewXoshiro128PP() *Xoshiro128PPState {
+	state := Xoshiro128PPState{
+		s: [4]uint32{0, 0, 0, 0},
+	}
+
+	return &state
+}
+
+func (state *Xoshiro128PPState) Next() uint32 {
+	return xoshiro128PPPermuteState(state.s[:])
+}
+
+// Jump advances the generator by 2^64 steps
+func (state *Xoshiro128PPState) Jump() {
+	state.Jump64()
+}
+
+func (state *Xoshiro128PPState) Jump64() {
+	jumpImpl(state.s[:], xoshiro128Jump64Table, xoshiro128PPPermuteState)
+}
+
+func (state *Xoshiro128PPState) Jump96() {
+	jumpImpl(state.s[:], xoshiro128Jump96Table, xoshiro128PPPermuteState)
+}
+
+func (state *Xoshiro128PPState) Advance(n uint64) {
+	Xoshiro128Advance(state.s[:], n)
+}
+
+func (state *Xoshiro128PPState) State() []uint32 {
+	return append([]uint32{}, state.s[:]...)
+}
+
+func (state *Xoshiro128PPState) SetState(s []uint32) error {
+	return setStateImpl(state.s[:], s)
+}
+
+func (state *Xoshiro128PPState) String() string {
+	s := ""
+
+	for i := 0; i < len(state.s); i++ {
+		s += fmt.Sprintf("%08X", state.s[i])
+	}
+
+	return s
+}
@@ -0,0 +1,56 @@
+package rng
+
+import "fmt"
+
+// Xoshiro128SSState is a xoshiro128** generator
+// https://prng.di.unimi.it/xoshiro128starstar.c
+type Xoshiro128SSState struct {
+	s [4]uint32
+}
+
+func NewXoshiro128SS() *Xoshiro128SSState {
+	state := Xoshiro128SSState{
+		s: [4]uint32{0, 0, 0, 0},
+	}
+
+	return &state
+}
+
+func (state *Xoshiro128SSState) Next() uint32 {
+	return xoshiro128SSPermuteState(state.s[:])
+}
+
+// Jump advances the generator by 2^64 steps
+func (state *Xoshiro128SSState) Jump() {
+	state.Jump64()
+}
+
+func (state *Xoshiro128SSState) Jump64() {
+	jumpImpl(state.s[:], xoshiro128Jump64Table, xoshiro128SSPermuteState)
+}
+
+func (state *Xoshiro128SSState) Jump96() {
+	jumpImpl(state.s[:], xoshiro128Jump96Table, xoshiro128SSPermuteState)
+}
+
+func (state *Xoshiro128SSState) Advance(n uint64) {
+	Xoshiro128Advance(state.s[:], n)
+}
+
+func (state *Xoshiro128SSState) State() []uint32 {
+	return append([]uint32{}, state.s[:]...)
+}
+
+func (state *Xoshiro128SSState) SetState(s []uint32) error {
+	return setStateImpl(state.s[:], s)
+}
+
+func (state *Xoshiro128SSState) String() string {
+	s := ""
+
+	for i := 0; i < len(state.s); i++ {
+		s += fmt.Sprintf("%08X", state.s[i])
+	}
+
+	return s
+}
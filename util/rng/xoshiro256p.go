@@ -0,0 +1,56 @@
+package rng
+
+import "fmt"
+
+// Xoshiro256PState is a xoshiro256+ generator
+// https://prng.di.unimi.it/xoshiro256plus.c
+type Xoshiro256PState struct {
+	s [4]uint64
+}
+
+func NewXoshiro256P() *Xoshiro256PState {
+	state := Xoshiro256PState{
+		s: [4]uint64{0, 0, 0, 0},
+	}
+
+	return &state
+}
+
+func (state *Xoshiro256PState) Next() uint64 {
+	return xoshiro256PPermuteState(state.s[:])
+}
+
+// Jump advances the generator by 2^128 steps
+func (state *Xoshiro256PState) Jump() {
+	state.Jump128()
+}
+
+func (state *Xoshiro256PState) Jump128() {
+	jumpImpl(state.s[:], xoshiro256Jump128Table, xoshiro256PPermuteState)
+}
+
+func (state *Xoshiro256PState) Jump192() {
+	jumpImpl(state.s[:], xoshiro256Jump192Table, xoshiro256PPermuteState)
+}
+
+func (state *Xoshiro256PState) Advance(n uint64) {
+	Xoshiro256Advance(state.s[:], n)
+}
+
+func (state *Xoshiro256PState) State() []uint64 {
+	return append([]uint64{}, state.s[:]...)
+}
+
+func (state *Xoshiro256PState) SetState(s []uint64) error {
+	return setStateImpl(state.s[:], s)
+}
+
+func (state *Xoshiro256PState) String() string {
+	s := ""
+
+	for i := 0; i < len(state.s); i++ {
+		s += fmt.Sprintf("%016X", state.s[i])
+	}
+
+	return s
+}
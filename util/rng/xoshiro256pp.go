@@ -1,52 +1,55 @@
 package rng
 
-import (
-	"fmt"
-)
+import "fmt"
 
+// Xoshiro256PPState is a xoshiro256++ generator
+// https://prng.di.unimi.it/xoshiro256plusplus.c
 type Xoshiro256PPState struct {
-	State [4]uint64
+	s [4]uint64
 }
 
 func NewXoshiro256PP() *Xoshiro256PPState {
 	state := Xoshiro256PPState{
-		State: [4]uint64{0, 0, 0, 0},
+		s: [4]uint64{0, 0, 0, 0},
 	}
 
 	return &state
 }
 
 func (state *Xoshiro256PPState) Next() uint64 {
-	return xoshiro256PPPermuteState(state.State[:])
+	return xoshiro256PPPermuteState(state.s[:])
 }
 
-func (state *Xoshiro256PPState) Jump128() {
-	var jump = [4]uint64{
-		0x180ec6d33cfd0aba,
-		0xd5a61266f0c9392c,
-		0xa9582618e03fc9aa,
-		0x39abdc4529b1661c,
-	}
+// Jump advances the generator by 2^128 steps
+func (state *Xoshiro256PPState) Jump() {
+	state.Jump128()
+}
 
-	jumpImpl(state.State[:], jump[:], xoshiro256PPPermuteState)
+func (state *Xoshiro256PPState) Jump128() {
+	jumpImpl(state.s[:], xoshiro256Jump128Table, xoshiro256PPPermuteState)
 }
 
 func (state *Xoshiro256PPState) Jump192() {
-	var jump = [4]uint64{
-		0x76e15d3efefdcbbf,
-		0xc5004e441c522fb3,
-		0x77710069854ee241,
-		0x39109bb02acbe635,
-	}
+	jumpImpl(state.s[:], xoshiro256Jump192Table, xoshiro256PPPermuteState)
+}
+
+func (state *Xoshiro256PPState) Advance(n uint64) {
+	Xoshiro256Advance(state.s[:], n)
+}
+
+func (state *Xoshiro256PPState) State() []uint64 {
+	return append([]uint64{}, state.s[:]...)
+}
 
-	jumpImpl(state.State[:], jump[:], xoshiro256PPPermuteState)
+func (state *Xoshiro256PPState) SetState(s []uint64) error {
+	return setStateImpl(state.s[:], s)
 }
 
 func (state *Xoshiro256PPState) String() string {
 	s := ""
 
-	for i := 0; i < 4; i++ {
-		s += fmt.Sprintf("%016X", state.State[0])
+	for i := 0; i < len(state.s); i++ {
+		s += fmt.Sprintf("%016X", state.s[i])
 	}
 
 	return s
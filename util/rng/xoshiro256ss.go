@@ -0,0 +1,56 @@
+package rng
+
+import "fmt"
+
+// Xoshiro256SSState is a xoshiro256** generator
+// https://prng.di.unimi.it/xoshiro256starstar.c
+type Xoshiro256SSState struct {
+	s [4]uint64
+}
+
+func NewXoshiro256SS() *Xoshiro256SSState {
+	state := Xoshiro256SSState{
+		s: [4]uint64{0, 0, 0, 0},
+	}
+
+	return &state
+}
+
+func (state *Xoshiro256SSState) Next() uint64 {
+	return xoshiro256SSPermuteState(state.s[:])
+}
+
+// Jump advances the generator by 2^128 steps
+func (state *Xoshiro256SSState) Jump() {
+	state.Jump128()
+}
+
+func (state *Xoshiro256SSState) Jump128() {
+	jumpImpl(state.s[:], xoshiro256Jump128Table, xoshiro256SSPermuteState)
+}
+
+func (state *Xoshiro256SSState) Jump192() {
+	jumpImpl(state.s[:], xoshiro256Jump192Table, xoshiro256SSPermuteState)
+}
+
+func (state *Xoshiro256SSState) Advance(n uint64) {
+	Xoshiro256Advance(state.s[:], n)
+}
+
+func (state *Xoshiro256SSState) State() []uint64 {
+	return append([]uint64{}, state.s[:]...)
+}
+
+func (state *Xoshiro256SSState) SetState(s []uint64) error {
+	return setStateImpl(state.s[:], s)
+}
+
+func (state *Xoshiro256SSState) String() string {
+	s := ""
+
+	for i := 0; i < len(state.s); i++ {
+		s += fmt.Sprintf("%016X", state.s[i])
+	}
+
+	return s
+}